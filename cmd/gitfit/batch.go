@@ -0,0 +1,410 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nabiladem/git-fit/internal/compressor"
+)
+
+// defaultNameTemplate keeps the input name and swaps in the output format's extension
+const defaultNameTemplate = "{name}.{ext}"
+
+// templateFields matches the {field} placeholders of a name template
+var templateFields = regexp.MustCompile(`\{[a-z]*\}`)
+
+// batchResult is the outcome of one file of a batch run
+/* Input (string) - input path; Output (string) - output path, empty when nothing was written
+   Result (*compressor.Result) - compression result; Skipped (string) - why the file was left alone
+   Err (error) - why the file failed; Elapsed (time.Duration) - time spent compressing */
+type batchResult struct {
+	Input   string
+	Output  string
+	Result  *compressor.Result
+	Skipped string
+	Err     error
+	Elapsed time.Duration
+}
+
+// isBatchInput() - report whether -input names a directory or a glob rather than a single file
+/* path (string) - value of -input */
+func isBatchInput(path string) bool {
+	if strings.ContainsAny(path, "*?[") {
+		return true
+	}
+
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// validateBatch() - check the settings that only apply to directory or glob input
+/* cfg (*Config) - configuration for compression */
+func validateBatch(cfg *Config) error {
+	if cfg.Variants != "" || cfg.Srcset != "" || cfg.UploadGravatar || cfg.CirclePreview != "" {
+		return fmt.Errorf("directory or glob input cannot be combined with -variants, -srcset, -upload-gravatar or -circle-preview")
+	}
+
+	if info, err := os.Stat(cfg.OutputPath); err == nil && !info.IsDir() {
+		return fmt.Errorf("-output must be a directory when -input is a directory or glob")
+	}
+
+	if cfg.DryRun && (cfg.Manifest != "" || cfg.Resume != "") {
+		return fmt.Errorf("-manifest and -resume cannot be combined with -dry-run")
+	}
+
+	for _, path := range []string{cfg.Manifest, cfg.Resume} {
+		if path != "" {
+			if err := validManifestPath(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	if cfg.Jobs < 1 {
+		return fmt.Errorf("value for -jobs must be at least 1")
+	}
+
+	if err := validateNameTemplate(cfg); err != nil {
+		return err
+	}
+
+	inputs, err := expandInputs(cfg.InputPath)
+	if err != nil {
+		return err
+	}
+
+	if len(inputs) == 0 {
+		return fmt.Errorf("no files match %s", cfg.InputPath)
+	}
+
+	return nil
+}
+
+// validateNameTemplate() - check the fields of -name, defaulting it when empty
+/* cfg (*Config) - configuration for compression */
+func validateNameTemplate(cfg *Config) error {
+	if cfg.NameTemplate == "" {
+		cfg.NameTemplate = defaultNameTemplate
+	}
+
+	for _, field := range templateFields.FindAllString(cfg.NameTemplate, -1) {
+		switch field {
+		case "{name}", "{ext}", "{format}", "{width}", "{height}", "{quality}":
+		default:
+			return fmt.Errorf("value for -name has unknown field %s", field)
+		}
+	}
+
+	return nil
+}
+
+// expandInputs() - list the files of a directory (not recursing) or matching a glob, sorted by name
+/* pattern (string) - directory path or glob */
+func expandInputs(pattern string) ([]string, error) {
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		pattern = filepath.Join(pattern, "*")
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -input pattern %s: %v", pattern, err)
+	}
+
+	var files []string
+	for _, m := range matches {
+		// skip directories and dotfiles such as .DS_Store
+		if info, err := os.Stat(m); err != nil || info.IsDir() || strings.HasPrefix(filepath.Base(m), ".") {
+			continue
+		}
+		files = append(files, m)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// runBatch() - compress every input of a directory or glob with a pool of workers and print a summary
+/* cfg (*Config) - configuration for compression */
+func runBatch(cfg *Config) error {
+	opts, err := compressOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	// per-file logs of concurrent workers would interleave, the summary reports instead
+	opts.Verbose = false
+
+	inputs, err := expandInputs(cfg.InputPath)
+	if err != nil {
+		return err
+	}
+
+	if !cfg.DryRun {
+		if err := os.MkdirAll(cfg.OutputPath, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %v", err)
+		}
+	}
+
+	// inputs an earlier run already finished with the same settings are skipped
+	previous := map[string]manifestEntry{}
+	if cfg.Resume != "" {
+		if previous, err = loadManifest(cfg.Resume); err != nil {
+			return err
+		}
+	}
+
+	// the manifest carries earlier entries forward, -resume alone updates the manifest it resumed from
+	var mf *manifest
+	if path := cmp.Or(cfg.Manifest, cfg.Resume); path != "" {
+		mf = &manifest{path: path, entries: maps.Clone(previous)}
+	}
+	params := batchParams(cfg)
+
+	// outputs claimed so far, two inputs must never write the same file
+	var mu sync.Mutex
+	claimed := map[string]string{}
+	claim := func(output, input string) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if other, ok := claimed[output]; ok {
+			return fmt.Errorf("output %s is also produced by %s; add {format} or {width} to -name", output, other)
+		}
+		claimed[output] = input
+		return nil
+	}
+
+	results := make([]batchResult, len(inputs))
+	work := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(cfg.Jobs, len(inputs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				sum := ""
+				if mf != nil {
+					var err error
+					if sum, err = hashFile(inputs[i]); err != nil {
+						results[i] = batchResult{Input: inputs[i], Err: err}
+						mf.record(manifestEntryFor(results[i], sum, params))
+						continue
+					}
+				}
+
+				if e, ok := previous[inputs[i]]; ok && resumable(e, sum, params) {
+					results[i] = batchResult{Input: inputs[i], Output: e.Output, Skipped: "unchanged since the last run"}
+					if e.Output != "" {
+						claim(e.Output, inputs[i])
+					}
+				} else {
+					results[i] = compressOne(cfg, opts, inputs[i], i, claim)
+					if mf != nil {
+						mf.record(manifestEntryFor(results[i], sum, params))
+					}
+				}
+
+				if cfg.JSON {
+					writeReport(batchReport(results[i], cfg.DryRun))
+				} else if cfg.Verbose {
+					mu.Lock()
+					printBatchResult(results[i])
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := range inputs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	var compressed, skipped, failed int
+	for _, r := range results {
+		if !cfg.Verbose && !cfg.JSON {
+			printBatchResult(r)
+		}
+
+		switch {
+		case r.Err != nil:
+			failed++
+		case r.Skipped != "":
+			skipped++
+		default:
+			compressed++
+		}
+	}
+
+	verb := "compressed"
+	if cfg.DryRun {
+		verb = "planned"
+	}
+	if !cfg.JSON {
+		fmt.Fprintf(stdout, "%d files: %d %s, %d skipped, %d failed\n", len(results), compressed, verb, skipped, failed)
+	}
+
+	if mf != nil {
+		// written even when every input was resumed, so a new -manifest is complete
+		if err := mf.flush(); err != nil {
+			return err
+		}
+
+		if cfg.Verbose {
+			fmt.Fprintln(stdout, "Manifest written to", mf.path)
+		}
+	}
+
+	if failed > 0 {
+		// every failure already has its own line
+		if cfg.JSON {
+			return errReported
+		}
+
+		return fmt.Errorf("%d of %d files failed", failed, len(results))
+	}
+
+	return nil
+}
+
+// compressOne() - compress one batch input into the output directory under its templated name
+/* cfg (*Config) - configuration for compression; opts (compressor.Options) - shared compressor options
+   input (string) - input path; index (int) - position of the input, keeps temp names unique
+   claim (func(string, string) error) - reserves an output path for this input */
+func compressOne(cfg *Config, opts compressor.Options, input string, index int, claim func(string, string) error) batchResult {
+	res := batchResult{Input: input}
+
+	detected, err := compressor.DetectFormat(input)
+	if err != nil {
+		res.Skipped = "not a supported image"
+		return res
+	}
+
+	format, ok := compressor.DefaultOutputFormat(detected)
+	if cfg.OutputFormat != "" {
+		format, ok = cfg.OutputFormat, true
+	}
+	if !ok {
+		res.Err = withCode(codeInvalidArguments, fmt.Errorf("no output format for %s input, set -format", detected))
+		return res
+	}
+	opts.OutputFormat = format
+
+	if cfg.MaxSizePercent > 0 {
+		if info, err := os.Stat(input); err == nil {
+			opts.MaxSize = compressor.Size{Percent: cfg.MaxSizePercent}.Resolve(info.Size())
+		}
+	}
+
+	if cfg.SkipUnderCap && format == detected {
+		if info, err := os.Stat(input); err == nil && info.Size() <= int64(opts.MaxSize) {
+			res.Skipped = fmt.Sprintf("already %s, under the cap", formatBytes(info.Size()))
+			return res
+		}
+	}
+
+	// compress next to the final file, its name depends on the result
+	tmp := filepath.Join(cfg.OutputPath, fmt.Sprintf(".gitfit-%d-%d.tmp", os.Getpid(), index))
+	defer os.Remove(tmp)
+
+	start := time.Now()
+	res.Result, err = compressor.Compress(input, tmp, opts)
+	res.Elapsed = time.Since(start)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	output := filepath.Join(cfg.OutputPath, expandName(cfg.NameTemplate, input, res.Result))
+	if err := claim(output, input); err != nil {
+		res.Err = withCode(codeOutputExists, err)
+		return res
+	}
+
+	if cfg.DryRun {
+		res.Output = output
+		return res
+	}
+
+	if err := placeOutput(cfg, input, tmp, output); err != nil {
+		res.Err = err
+		return res
+	}
+
+	res.Output = output
+	return res
+}
+
+// placeOutput() - move a finished temp file to its output path, honoring -force and -backup
+/* cfg (*Config) - configuration for compression; input (string) - input path
+   tmp (string) - compressed temp file; output (string) - final path */
+func placeOutput(cfg *Config, input, tmp, output string) error {
+	if _, err := os.Stat(output); err == nil {
+		switch {
+		case cfg.Backup:
+			if _, err := compressor.BackupFile(output); err != nil {
+				return err
+			}
+		case !cfg.Force && sameFile(input, output):
+			return withCode(codeOutputExists, fmt.Errorf("output %s is the input file; use -force to replace it or -backup to keep a copy", output))
+		case !cfg.Force:
+			return withCode(codeOutputExists, fmt.Errorf("output file %s already exists; use -force to overwrite it or -backup to keep a copy", output))
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, output)
+}
+
+// expandName() - fill in a name template for one output
+/* tmpl (string) - template such as {name}_{width}.{ext}; input (string) - input path
+   result (*compressor.Result) - compression result */
+func expandName(tmpl, input string, result *compressor.Result) string {
+	ext := result.Format
+	if enc, ok := compressor.LookupEncoder(result.Format); ok {
+		ext = strings.TrimPrefix(enc.Extensions()[0], ".")
+	}
+
+	base := filepath.Base(input)
+	return strings.NewReplacer(
+		"{name}", strings.TrimSuffix(base, filepath.Ext(base)),
+		"{ext}", ext,
+		"{format}", result.Format,
+		"{width}", strconv.Itoa(result.Width),
+		"{height}", strconv.Itoa(result.Height),
+		"{quality}", strconv.Itoa(result.Quality),
+	).Replace(tmpl)
+}
+
+// printBatchResult() - print the summary line of one batch input
+/* r (batchResult) - outcome to print */
+func printBatchResult(r batchResult) {
+	switch {
+	case r.Err != nil:
+		fmt.Fprintf(stdout, "FAIL  %s: %v\n", r.Input, r.Err)
+	case r.Skipped != "":
+		fmt.Fprintf(stdout, "skip  %s: %s\n", r.Input, r.Skipped)
+	default:
+		fmt.Fprintf(stdout, "ok    %s -> %s (%dx%d, %s)\n", r.Input, r.Output, r.Result.Width, r.Result.Height, formatBytes(int64(r.Result.Size)))
+	}
+}
+
+// formatBytes() - format a byte count as KB with two decimals, like the rest of the CLI output
+/* n (int64) - number of bytes */
+func formatBytes(n int64) string {
+	return fmt.Sprintf("%.2f KB", float64(n)/1024.0)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nabiladem/git-fit/internal/server"
+)
+
+// stdout is where commands print their results, swapped out by tests
+var stdout io.Writer = os.Stdout
+
+// errUsage reports that usage was printed instead of running, main() exits non-zero without another message
+var errUsage = errors.New("usage")
+
+// command is one gitfit subcommand
+/* Name (string) - word typed after gitfit; Summary (string) - one-line description for the command list
+   Run (func([]string) error) - runs the command with the arguments after its name */
+type command struct {
+	Name    string
+	Summary string
+	Run     func(args []string) error
+}
+
+// commands() - list the subcommands in the order they are shown in the usage
+func commands() []command {
+	return []command{
+		{"compress", "Compress an image to fit a size cap (the default, 'gitfit -input ...' still works)", runCompressCommand},
+		{"watch", "Compress images dropped into a folder as they arrive: gitfit watch -output <dir> <dir>", runWatch},
+		{"upload", "Upload an image to an avatar service: gitfit upload gravatar <image>", runUpload},
+		{"auth", "Manage the saved Gravatar login: gitfit auth login|logout|status", runAuth},
+		{"inspect", "Show the format, dimensions, metadata and preset fit of images", runInspect},
+		{"presets", "List the presets usable with compress -preset", runPresets},
+		{"config", "Show the effective compress settings from config files and GITFIT_* variables: gitfit config show", runConfig},
+		{"placeholder", "Print BlurHash and ThumbHash placeholders of images", func(args []string) error { return runPlaceholder(args, stdout) }},
+		{"serve", "Run the web API", runServe},
+	}
+}
+
+// run() - dispatch arguments to a subcommand, flags without a command go to compress for compatibility
+/* args ([]string) - command-line arguments without the program name */
+func run(args []string) error {
+	if len(args) == 0 {
+		printUsage()
+		return errUsage
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		printUsage()
+		return nil
+	}
+
+	// the flat invocation predates subcommands
+	if strings.HasPrefix(args[0], "-") {
+		return runCompressCommand(args)
+	}
+
+	for _, cmd := range commands() {
+		if cmd.Name == args[0] {
+			return cmd.Run(args[1:])
+		}
+	}
+
+	return fmt.Errorf("unknown command %q, run 'gitfit help' to list commands", args[0])
+}
+
+// printUsage() - print the list of subcommands
+func printUsage() {
+	fmt.Fprintln(stdout, "Usage: gitfit <command> [flags]")
+	fmt.Fprintln(stdout)
+	fmt.Fprintln(stdout, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(stdout, "  %-12s %s\n", cmd.Name, cmd.Summary)
+	}
+	fmt.Fprintln(stdout)
+	fmt.Fprintln(stdout, "Run 'gitfit <command> -h' for the flags of a command.")
+}
+
+// parseCommandFlags() - parse the flags of a subcommand, printing its usage on -h
+/* fs (*flag.FlagSet) - flags of the command; usage (string) - usage line; args ([]string) - arguments to parse */
+func parseCommandFlags(fs *flag.FlagSet, usage string, args []string) error {
+	fs.Usage = func() {
+		fmt.Fprintln(stdout, "Usage:", usage)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return errUsage
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// runServe() - run the web API in the foreground
+/* args ([]string) - serve flags */
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	port := fs.String("port", "", "Port to listen on (default $PORT or 8080)")
+	if err := parseCommandFlags(fs, "gitfit serve [-port <port>]", args); err != nil {
+		return err
+	}
+
+	return server.Run(*port)
+}
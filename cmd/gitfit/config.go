@@ -0,0 +1,369 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// userConfigDir is swapped out by tests so they never read the real config directory
+var userConfigDir = os.UserConfigDir
+
+// configNames are the file names looked up for the user and project config, in order of preference
+var configNames = []string{"config.yaml", "config.yml", "config.toml"}
+
+// projectConfigNames are looked up in the working directory and its parents
+var projectConfigNames = []string{".gitfit.yaml", ".gitfit.yml", ".gitfit.toml"}
+
+// envPrefix starts the environment variables overriding compress flags, e.g. GITFIT_MAXSIZE
+const envPrefix = "GITFIT_"
+
+// configurable are the compress flags config files, profiles and GITFIT_* variables may set: encoding and
+// tuning settings only, so a stray project file cannot change which files a run reads, writes or overwrites
+var configurable = map[string]bool{
+	"maxsize": true, "format": true, "quality": true, "min-ssim": true, "svg-size": true,
+	"crop": true, "focus": true, "pad": true, "safezone": true, "placeholder": true,
+	"srcset-formats": true, "snippet": true, "url-prefix": true, "alt": true,
+	"jobs": true, "skip-under-cap": true, "preset": true, "v": true,
+	"download-timeout": true, "max-download": true,
+}
+
+// configFile is a parsed user or project config file
+/* Path (string) - where the file was read from; Flags (map[string]string) - compress flag values at the top level
+   Profiles (map[string]map[string]string) - flag values under profiles:, selected with -profile */
+type configFile struct {
+	Path     string
+	Flags    map[string]string
+	Profiles map[string]map[string]string
+}
+
+// setting is the effective value of one compress flag and where it came from
+/* Value (string) - flag value as typed on the command line; Source (string) - layer that set it, for `config show` */
+type setting struct {
+	Value  string
+	Source string
+}
+
+// configLayer is one level of the precedence chain
+/* flags (map[string]string) - values set by the layer; source (string) - description of the layer */
+type configLayer struct {
+	flags  map[string]string
+	source string
+}
+
+// envVar() - name of the environment variable overriding a flag
+/* name (string) - flag name */
+func envVar(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// userConfigPath() - path of the user config file, the YAML name when none exists yet
+func userConfigPath() (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate config directory: %v", err)
+	}
+
+	return findConfig(filepath.Join(dir, "gitfit"), configNames), nil
+}
+
+// projectConfigPath() - path of the nearest project config in the working directory or its parents, "" when there is none
+func projectConfigPath() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	for {
+		if path := findConfig(dir, projectConfigNames); fileExists(path) {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// findConfig() - first of names present in dir, or the first name when none is
+/* dir (string) - directory to look in; names ([]string) - candidate file names */
+func findConfig(dir string, names []string) string {
+	for _, name := range names {
+		if path := filepath.Join(dir, name); fileExists(path) {
+			return path
+		}
+	}
+
+	return filepath.Join(dir, names[0])
+}
+
+// fileExists() - report whether path is an existing regular file
+/* path (string) - file path */
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// loadConfigFile() - read a YAML or TOML config file, returns nil without an error when it does not exist
+/* path (string) - config file path; fs (*flag.FlagSet) - compress flags the keys must name */
+func loadConfigFile(path string, fs *flag.FlagSet) (*configFile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	raw := map[string]any{}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = toml.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	cfg := &configFile{Path: path, Profiles: map[string]map[string]string{}}
+
+	profiles, _ := raw["profiles"].(map[string]any)
+	if _, ok := raw["profiles"]; ok && profiles == nil {
+		return nil, fmt.Errorf("%s: profiles must map profile names to flag values", path)
+	}
+	delete(raw, "profiles")
+
+	if cfg.Flags, err = configFlags(raw, fs); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	for name, values := range profiles {
+		m, ok := values.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: profile %s must map flag names to values", path, name)
+		}
+
+		if cfg.Profiles[name], err = configFlags(m, fs); err != nil {
+			return nil, fmt.Errorf("%s: profile %s: %v", path, name, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// configFlags() - turn decoded config values into flag values, rejecting keys that are not configurable compress flags
+/* raw (map[string]any) - decoded keys and values; fs (*flag.FlagSet) - compress flags */
+func configFlags(raw map[string]any, fs *flag.FlagSet) (map[string]string, error) {
+	flags := make(map[string]string, len(raw))
+
+	for name, value := range raw {
+		if name == "profile" {
+			return nil, fmt.Errorf("profile cannot be set in a config file, pass -profile or set %s", envVar("profile"))
+		}
+
+		if fs.Lookup(name) == nil {
+			return nil, fmt.Errorf("unknown setting %q, keys are compress flag names such as maxsize or format", name)
+		}
+
+		if !configurable[name] {
+			return nil, fmt.Errorf("%s cannot be set in a config file, pass -%s on the command line", name, name)
+		}
+
+		switch value.(type) {
+		case map[string]any, []any, nil:
+			return nil, fmt.Errorf("value for %s must be a single value", name)
+		}
+
+		flags[name] = fmt.Sprint(value)
+	}
+
+	return flags, nil
+}
+
+// envFlags() - configurable compress flag values given as GITFIT_* environment variables
+/* fs (*flag.FlagSet) - compress flags */
+func envFlags(fs *flag.FlagSet) map[string]string {
+	flags := map[string]string{}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if value, ok := os.LookupEnv(envVar(f.Name)); ok && configurable[f.Name] {
+			flags[f.Name] = value
+		}
+	})
+
+	return flags
+}
+
+// configLayers() - the config files, the selected profile and the environment, from lowest to highest precedence
+/* fs (*flag.FlagSet) - compress flags; profile (string) - profile to apply from the config files, "" for none */
+func configLayers(fs *flag.FlagSet, profile string) ([]configLayer, error) {
+	userPath, err := userConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	var layers []configLayer
+	found := false
+
+	for _, file := range []struct{ path, kind string }{{userPath, "user"}, {projectConfigPath(), "project"}} {
+		if file.path == "" {
+			continue
+		}
+
+		cfg, err := loadConfigFile(file.path, fs)
+		if err != nil {
+			return nil, err
+		}
+		if cfg == nil {
+			continue
+		}
+
+		layers = append(layers, configLayer{cfg.Flags, file.kind + " config " + cfg.Path})
+
+		// a profile overrides the top level of the same file, so a project profile beats the user one
+		if values, ok := cfg.Profiles[profile]; ok && profile != "" {
+			layers = append(layers, configLayer{values, fmt.Sprintf("profile %s in %s", profile, cfg.Path)})
+			found = true
+		}
+	}
+
+	if profile != "" && !found {
+		return nil, fmt.Errorf("unknown profile %q, define it under profiles: in %s or a project .gitfit.yaml", profile, userPath)
+	}
+
+	return append(layers, configLayer{envFlags(fs), "environment"}), nil
+}
+
+// resolveSettings() - merge the config layers and the command line into the effective flag values
+/* fs (*flag.FlagSet) - parsed compress flags */
+func resolveSettings(fs *flag.FlagSet) (map[string]setting, error) {
+	given := map[string]string{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = f.Value.String() })
+
+	profile, ok := given["profile"]
+	if !ok {
+		profile = os.Getenv(envVar("profile"))
+	}
+
+	layers, err := configLayers(fs, profile)
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, configLayer{given, "command line"})
+
+	settings := map[string]setting{}
+	fs.VisitAll(func(f *flag.Flag) { settings[f.Name] = setting{f.DefValue, "default"} })
+
+	for _, layer := range layers {
+		// a preset sits just below the layer naming it, unknown presets are reported by validateConfig
+		if p, ok := lookupPreset(layer.flags["preset"]); ok {
+			for name, value := range p.Flags {
+				settings[name] = setting{value, "preset " + p.Name}
+			}
+		}
+
+		for name, value := range layer.flags {
+			source := layer.source
+			if source == "environment" {
+				source = "env " + envVar(name)
+			}
+			settings[name] = setting{value, source}
+		}
+	}
+
+	return settings, nil
+}
+
+// applySettings() - set flags not given on the command line from presets, config files and the environment
+/* fs (*flag.FlagSet) - parsed compress flags */
+func applySettings(fs *flag.FlagSet) error {
+	settings, err := resolveSettings(fs)
+	if err != nil {
+		return err
+	}
+
+	for name, s := range settings {
+		if s.Source == "default" || s.Source == "command line" {
+			continue
+		}
+
+		if err := fs.Set(name, s.Value); err != nil {
+			return fmt.Errorf("invalid value %q for %s from %s: %v", s.Value, name, s.Source, err)
+		}
+	}
+
+	return nil
+}
+
+// runConfig() - print the effective compress settings and where each one comes from
+/* args ([]string) - "show" followed by optional -profile */
+func runConfig(args []string) error {
+	const usage = "gitfit config show [-profile <name>]"
+
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintln(stdout, "Usage:", usage)
+		return errUsage
+	}
+
+	fs, _ := newCompressFlagSet(flag.ContinueOnError)
+	show := flag.NewFlagSet("config show", flag.ContinueOnError)
+	profile := show.String("profile", "", "Show the settings with this profile applied")
+	if err := parseCommandFlags(show, usage, args[1:]); err != nil {
+		return err
+	}
+
+	if *profile != "" {
+		fs.Set("profile", *profile)
+	}
+
+	settings, err := resolveSettings(fs)
+	if err != nil {
+		return err
+	}
+
+	userPath, err := userConfigPath()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "User config:    %s%s\n", userPath, missingNote(userPath))
+	if path := projectConfigPath(); path != "" {
+		fmt.Fprintf(stdout, "Project config: %s\n", path)
+	} else {
+		fmt.Fprintln(stdout, "Project config: none (.gitfit.yaml in this directory or a parent)")
+	}
+	fmt.Fprintln(stdout)
+
+	names := make([]string, 0, len(settings))
+	for name, s := range settings {
+		// unset text flags such as -input are noise here
+		if s.Value != "" || s.Source != "default" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		s := settings[name]
+		fmt.Fprintf(stdout, "%-16s %-12s (%s)\n", name, s.Value, s.Source)
+	}
+
+	return nil
+}
+
+// missingNote() - " (not found)" when path does not exist, for `config show`
+/* path (string) - config file path */
+func missingNote(path string) string {
+	if fileExists(path) {
+		return ""
+	}
+
+	return " (not found)"
+}
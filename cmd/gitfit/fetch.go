@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// defaultMaxDownload is the largest URL -input accepted unless -max-download says otherwise
+const defaultMaxDownload = 50 << 20
+
+// isURL() - report whether -input names an http or https URL rather than a file
+/* path (string) - value of -input */
+func isURL(path string) bool {
+	u, err := url.Parse(path)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// downloadInput() - fetch a URL -input into a temp file, so it is sniffed and decoded like any other input
+/* cfg (*Config) - configuration with the URL in InputPath and the download limits */
+func downloadInput(cfg *Config) (string, error) {
+	if cfg.MaxDownload <= 0 {
+		return "", withCode(codeInvalidArguments, fmt.Errorf("value for -max-download must be a size in bytes, such as 20MB"))
+	}
+
+	client := &http.Client{Timeout: cfg.DownloadTimeout}
+	req, err := http.NewRequest(http.MethodGet, cfg.InputPath, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "gitfit")
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %v", cfg.InputPath, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s: %s", cfg.InputPath, resp.Status)
+	}
+
+	// octet-stream is left to content sniffing, anything else that is not an image is most likely an error page
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || (!strings.HasPrefix(mediaType, "image/") && mediaType != "application/octet-stream") {
+			return "", fmt.Errorf("%s is not an image (Content-Type %s)", cfg.InputPath, ct)
+		}
+	}
+
+	if resp.ContentLength > int64(cfg.MaxDownload) {
+		return "", fmt.Errorf("%s is %s, larger than -max-download %s", cfg.InputPath, formatBytes(resp.ContentLength), formatBytes(int64(cfg.MaxDownload)))
+	}
+
+	f, err := os.CreateTemp("", "gitfit-download-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to buffer download: %v", err)
+	}
+	defer f.Close()
+
+	// servers may leave out or understate Content-Length, so read at most one byte past the limit
+	n, err := io.Copy(f, io.LimitReader(resp.Body, int64(cfg.MaxDownload)+1))
+	switch {
+	case err != nil:
+		err = fmt.Errorf("failed to download %s: %v", cfg.InputPath, err)
+	case n > int64(cfg.MaxDownload):
+		err = fmt.Errorf("%s is larger than -max-download %s", cfg.InputPath, formatBytes(int64(cfg.MaxDownload)))
+	case n == 0:
+		err = fmt.Errorf("%s returned no data", cfg.InputPath)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	if cfg.Verbose {
+		fmt.Fprintf(stdout, "Downloaded %s from %s\n", formatBytes(n), cfg.InputPath)
+	}
+
+	return f.Name(), nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nabiladem/git-fit/internal/compressor"
+	"github.com/nabiladem/git-fit/internal/gravatar"
+)
+
+// runUpload() - upload an image to an avatar service, only Gravatar for now
+/* args ([]string) - service name followed by its flags and the image path */
+func runUpload(args []string) error {
+	if len(args) == 0 || args[0] != "gravatar" {
+		fmt.Fprintln(stdout, "Usage: gitfit upload gravatar [-crop <mode> | -pad <blur|color>] [-v] <image>")
+		return errUsage
+	}
+
+	fs := flag.NewFlagSet("upload gravatar", flag.ContinueOnError)
+	crop := fs.String("crop", "", "How to make a non-square image square (center, smart, or x,y,w,h; center by default)")
+	pad := fs.String("pad", "", "Pad to a square instead of cropping; background is blur, white, black, transparent, or a hex color")
+	verbose := fs.Bool("v", false, "Verbose logging enabled")
+	if err := parseCommandFlags(fs, "gitfit upload gravatar [-crop <mode> | -pad <blur|color>] [-v] <image>", args[1:]); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	spec, err := compressor.ParseCrop(*crop)
+	if err != nil {
+		return fmt.Errorf("value for -crop is invalid: %v", err)
+	}
+
+	if *pad != "" {
+		if *crop != "" {
+			return fmt.Errorf("-pad cannot be combined with -crop")
+		}
+
+		bg, err := compressor.ParsePadBackground(*pad)
+		if err != nil {
+			return fmt.Errorf("value for -pad is invalid: %v", err)
+		}
+		spec = compressor.CropSpec{Mode: compressor.CropPad, Pad: bg}
+	}
+
+	client, err := gravatarClient(*verbose)
+	if err != nil {
+		return err
+	}
+	client.Crop = spec
+
+	if err := client.UploadAvatar(fs.Arg(0)); err != nil {
+		return fmt.Errorf("failed to upload to Gravatar: %v", err)
+	}
+
+	fmt.Fprintln(stdout, "Successfully uploaded to Gravatar!")
+	return nil
+}
+
+// runAuth() - log in to Gravatar once and keep the token, log out, or show the login state
+/* args ([]string) - login, logout or status followed by its flags */
+func runAuth(args []string) error {
+	usage := "gitfit auth login|logout|status"
+	if len(args) == 0 {
+		fmt.Fprintln(stdout, "Usage:", usage)
+		return errUsage
+	}
+
+	fs := flag.NewFlagSet("auth "+args[0], flag.ContinueOnError)
+	verbose := fs.Bool("v", false, "Verbose logging enabled")
+	if err := parseCommandFlags(fs, "gitfit auth "+args[0]+" [-v]", args[1:]); err != nil {
+		return err
+	}
+
+	path, err := gravatar.TokenPath()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "login":
+		client, err := loginGravatar(*verbose)
+		if err != nil {
+			return err
+		}
+
+		if err := gravatar.SaveToken(client.AccessToken); err != nil {
+			return err
+		}
+
+		fmt.Fprintln(stdout, "Logged in to Gravatar, token saved to", path)
+
+	case "logout":
+		removed, err := gravatar.DeleteToken()
+		if err != nil {
+			return err
+		}
+
+		if removed {
+			fmt.Fprintln(stdout, "Logged out of Gravatar")
+		} else {
+			fmt.Fprintln(stdout, "Not logged in to Gravatar")
+		}
+
+	case "status":
+		token, err := gravatar.LoadToken()
+		if errors.Is(err, gravatar.ErrNoToken) {
+			fmt.Fprintln(stdout, "Not logged in to Gravatar")
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(stdout, "Logged in to Gravatar since %s (token in %s)\n", token.SavedAt.Local().Format("2006-01-02 15:04"), path)
+
+	default:
+		fmt.Fprintln(stdout, "Usage:", usage)
+		return errUsage
+	}
+
+	return nil
+}
+
+// gravatarClient() - build a Gravatar client from the saved login, or sign in through the browser when there is none
+/* verbose (bool) - enable verbose logging */
+func gravatarClient(verbose bool) (*gravatar.Client, error) {
+	token, err := gravatar.LoadToken()
+	if errors.Is(err, gravatar.ErrNoToken) {
+		return loginGravatar(verbose)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if verbose {
+		fmt.Fprintln(stdout, "Using saved Gravatar login")
+	}
+
+	client := gravatar.NewClient("", "", "", verbose)
+	client.AccessToken = token.AccessToken
+	return client, nil
+}
+
+// loginGravatar() - run the OAuth flow with the credentials from the environment
+/* verbose (bool) - enable verbose logging */
+func loginGravatar(verbose bool) (*gravatar.Client, error) {
+	// load OAuth credentials from environment
+	clientID := os.Getenv("GRAVATAR_CLIENT_ID")
+	clientSecret := os.Getenv("GRAVATAR_CLIENT_SECRET")
+	redirectURI := os.Getenv("GRAVATAR_REDIRECT_URI")
+
+	if clientID == "" || clientSecret == "" {
+		return nil, fmt.Errorf("GRAVATAR_CLIENT_ID and GRAVATAR_CLIENT_SECRET environment variables must be set")
+	}
+
+	// use default redirect URI if not specified
+	if redirectURI == "" {
+		redirectURI = "http://localhost:8080/callback"
+	}
+
+	// create OAuth client
+	client := gravatar.NewClient(clientID, clientSecret, redirectURI, verbose)
+
+	// perform OAuth authentication
+	if verbose {
+		fmt.Fprintln(stdout, "Starting OAuth authentication...")
+		fmt.Fprintln(stdout, "Your browser will open for authorization.")
+	}
+
+	if err := client.Authenticate(); err != nil {
+		return nil, fmt.Errorf("OAuth authentication failed: %v", err)
+	}
+
+	return client, nil
+}
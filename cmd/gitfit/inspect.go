@@ -0,0 +1,215 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nabiladem/git-fit/internal/compressor"
+)
+
+// inspectJSON is one line of `gitfit inspect -json` output
+/* File (string) - image path; Format (string) - decoder name; Width, Height (int) - dimensions; Size (int64) - file size
+   ColorModel (string) - color model; HasAlpha (bool) - transparency in use; Frames (int) - animation frames
+   Orientation (int) - EXIF orientation, 0 when absent; GPS (bool) - EXIF carries a position
+   ICC (*iccJSON) - embedded color profile; Presets ([]presetEstimate) - dry run of each built-in preset */
+type inspectJSON struct {
+	File        string           `json:"file"`
+	Format      string           `json:"format"`
+	Width       int              `json:"width"`
+	Height      int              `json:"height"`
+	Size        int64            `json:"size"`
+	ColorModel  string           `json:"color_model"`
+	HasAlpha    bool             `json:"has_alpha"`
+	Frames      int              `json:"frames"`
+	Orientation int              `json:"exif_orientation,omitempty"`
+	GPS         bool             `json:"exif_gps"`
+	ICC         *iccJSON         `json:"icc_profile,omitempty"`
+	Presets     []presetEstimate `json:"presets,omitempty"`
+}
+
+// iccJSON describes an embedded color profile in `gitfit inspect -json` output
+/* Description (string) - profile name; ColorSpace (string) - data color space; Size (int) - bytes */
+type iccJSON struct {
+	Description string `json:"description"`
+	ColorSpace  string `json:"color_space"`
+	Size        int    `json:"size"`
+}
+
+// presetEstimate is the dry-run outcome of one preset for an inspected image
+/* Preset (string) - preset name; Reachable (bool) - the output fits the preset's cap
+   Width, Height (int) - output dimensions; Format (string) - output format
+   Size (int) - projected bytes; MaxSize (int) - the preset's cap; Error (string) - why the preset cannot be applied */
+type presetEstimate struct {
+	Preset    string `json:"preset"`
+	Reachable bool   `json:"reachable"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	Format    string `json:"format,omitempty"`
+	Size      int    `json:"size,omitempty"`
+	MaxSize   int    `json:"max_size"`
+	Error     string `json:"error,omitempty"`
+}
+
+// runInspect() - print what gitfit sees in each image and how each preset would turn out
+/* args ([]string) - inspect flags and image paths */
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print one JSON object per image")
+	estimate := fs.Bool("estimate", true, "Dry-run every preset to show whether it fits and at what width")
+	if err := parseCommandFlags(fs, "gitfit inspect [-json] [-estimate=false] <image>...", args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	enc := json.NewEncoder(stdout)
+	for i, path := range fs.Args() {
+		info, err := compressor.InspectFile(path)
+		if err != nil {
+			return err
+		}
+
+		var estimates []presetEstimate
+		if *estimate {
+			estimates = estimatePresets(path)
+		}
+
+		if *asJSON {
+			out := inspectJSON{
+				File:        path,
+				Format:      info.Format,
+				Width:       info.Width,
+				Height:      info.Height,
+				Size:        info.Size,
+				ColorModel:  info.ColorModel,
+				HasAlpha:    info.HasAlpha,
+				Frames:      info.Frames,
+				Orientation: info.Orientation,
+				GPS:         info.HasGPS,
+				Presets:     estimates,
+			}
+			if info.ICC != nil {
+				out.ICC = &iccJSON{Description: info.ICC.Description, ColorSpace: info.ICC.ColorSpace, Size: info.ICC.Size}
+			}
+
+			if err := enc.Encode(out); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if i > 0 {
+			fmt.Fprintln(stdout)
+		}
+		printInspect(path, info, estimates)
+	}
+
+	return nil
+}
+
+// printInspect() - print the text description of one image
+/* path (string) - image path; info (*compressor.ImageInfo) - what was decoded; estimates ([]presetEstimate) - preset dry runs */
+func printInspect(path string, info *compressor.ImageInfo, estimates []presetEstimate) {
+	fmt.Fprintln(stdout, path)
+	fmt.Fprintf(stdout, "  Format:     %s\n", info.Format)
+	fmt.Fprintf(stdout, "  Dimensions: %dx%d\n", info.Width, info.Height)
+	fmt.Fprintf(stdout, "  File size:  %d bytes (%.2f KB)\n", info.Size, float64(info.Size)/1024.0)
+	fmt.Fprintf(stdout, "  Color:      %s\n", info.ColorModel)
+	fmt.Fprintf(stdout, "  Alpha:      %v\n", info.HasAlpha)
+	fmt.Fprintf(stdout, "  Frames:     %d\n", info.Frames)
+
+	var exif []string
+	if info.Orientation != 0 {
+		exif = append(exif, fmt.Sprintf("orientation %d (%s)", info.Orientation, compressor.OrientationName(info.Orientation)))
+	}
+	if info.HasGPS {
+		exif = append(exif, "GPS position")
+	}
+	if len(exif) == 0 {
+		exif = append(exif, "none")
+	}
+	fmt.Fprintf(stdout, "  EXIF:       %s\n", strings.Join(exif, ", "))
+
+	if info.ICC != nil {
+		fmt.Fprintf(stdout, "  ICC:        %s (%s, %d bytes)\n", cmp.Or(info.ICC.Description, "unnamed"), cmp.Or(info.ICC.ColorSpace, "unknown"), info.ICC.Size)
+	} else {
+		fmt.Fprintln(stdout, "  ICC:        none")
+	}
+
+	if len(estimates) > 0 {
+		fmt.Fprintln(stdout, "  Presets (dry run):")
+	}
+	for _, e := range estimates {
+		switch {
+		case e.Error != "":
+			fmt.Fprintf(stdout, "    %-10s cannot be applied: %s\n", e.Preset, e.Error)
+		case e.Reachable:
+			fmt.Fprintf(stdout, "    %-10s fits at %dx%d %s, %s of %s\n", e.Preset, e.Width, e.Height, e.Format, formatBytes(int64(e.Size)), formatBytes(int64(e.MaxSize)))
+		default:
+			fmt.Fprintf(stdout, "    %-10s does not fit, %dx%d %s is still %s of %s\n", e.Preset, e.Width, e.Height, e.Format, formatBytes(int64(e.Size)), formatBytes(int64(e.MaxSize)))
+		}
+	}
+
+	// the encoders write no metadata, so the compressed copy loses both
+	if info.Orientation > 1 {
+		fmt.Fprintln(stdout, "  Note: compressing drops EXIF, so the output is not rotated the way viewers show this image")
+	}
+	if info.HasGPS {
+		fmt.Fprintln(stdout, "  Note: compressing drops EXIF, including the GPS position")
+	}
+}
+
+// estimatePresets() - dry-run every built-in preset on an image, in parallel since each one is a full search
+/* path (string) - image path */
+func estimatePresets(path string) []presetEstimate {
+	estimates := make([]presetEstimate, len(presets))
+
+	var wg sync.WaitGroup
+	for i, p := range presets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			estimates[i] = estimatePreset(path, p)
+		}()
+	}
+	wg.Wait()
+
+	return estimates
+}
+
+// estimatePreset() - dry-run one preset on an image, with the options compress -preset would use
+/* path (string) - image path; p (preset) - preset to try */
+func estimatePreset(path string, p preset) presetEstimate {
+	fs, build := newCompressFlagSet(flag.ContinueOnError)
+	for name, value := range p.Flags {
+		fs.Set(name, value)
+	}
+	cfg := build()
+
+	e := presetEstimate{Preset: p.Name, MaxSize: cfg.MaxSize}
+
+	opts, err := compressOptions(cfg)
+	if err != nil {
+		e.Error = err.Error()
+		return e
+	}
+	opts.DryRun, opts.Verbose = true, false
+
+	result, err := compressor.Compress(path, "", opts)
+	if err != nil {
+		e.Error = err.Error()
+		return e
+	}
+
+	e.Reachable = result.Reachable
+	e.Width, e.Height = result.Width, result.Height
+	e.Format, e.Size = result.Format, result.Size
+	return e
+}
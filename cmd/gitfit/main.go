@@ -3,91 +3,322 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nabiladem/git-fit/internal/compressor"
-	"github.com/nabiladem/git-fit/internal/gravatar"
 )
 
 // Config holds parsed command-line options
 /* InputPath (string) - path of the input image file; OutputPath (string) - path to save the compressed image
-   MaxSize (int) - maximum size of the image in bytes; OutputFormat (string) - jpeg, png, or gif
-   Quality (int) - quality for JPEG compression; Verbose (bool) - enable verbose logging */
+   MaxSize (int) - maximum size of the image in bytes; MaxSizePercent (float64) - when > 0, MaxSize is this share of the input size
+   OutputFormat (string) - name of a registered output format
+   Quality (int) - quality for JPEG compression; Verbose (bool) - enable verbose logging
+   Crop (string) - center, smart, or x,y,w,h; Focus (string) - x,y focus point as fractions of the image size
+   Pad (string) - pad to a square instead of cropping, with blur or a color as background
+   CirclePreview (string) - optional path for a PNG preview of the output under a circular avatar mask
+   SafeZone (bool) - warn when a circular avatar mask would hide a lot of detail, also on for avatar presets and -upload-gravatar
+   MinSSIM (float64) - when > 0, find the smallest output with at least this SSIM instead of the largest under MaxSize
+   DryRun (bool) - report what compression would produce without writing any files
+   SVGSize (int) - longest side SVG input is rasterized at, 0 for the default
+   Variants (string) - comma-separated size[:format[:maxbytes]] list, OutputPath is then a directory
+   Srcset (string) - comma-separated width ladder for responsive images, OutputPath is then a directory
+   SrcsetFormats (string) - formats for the ladder in order of preference; Snippet (string) - html or markdown
+   URLPrefix (string) - prefix for file references in the snippet; Alt (string) - alternative text for the snippet
+   Placeholder (bool) - print a BlurHash and ThumbHash of the output; Preset (string) - name of the preset flags came from
+   Profile (string) - config file profile flags came from
+   Jobs (int) - images compressed at once for directory or glob input; NameTemplate (string) - output name for each of them
+   SkipUnderCap (bool) - leave batch inputs already under MaxSize alone
+   Manifest (string) - JSON or CSV record of a batch run; Resume (string) - manifest of an earlier run to continue
+   JSON (bool) - print a JSON report instead of text; InputName (string) - how reports name the input when InputPath is a copy of stdin or a download
+   DownloadTimeout (time.Duration) - limit for fetching a URL -input; MaxDownload (int) - largest URL -input accepted, in bytes
+   Force (bool) - allow overwriting an existing output file; Backup (bool) - copy an existing output to <output>.bak first */
 type Config struct {
-	InputPath      string
-	OutputPath     string
-	MaxSize        int
-	OutputFormat   string
-	Quality        int
-	Verbose        bool
-	UploadGravatar bool
+	InputPath       string
+	OutputPath      string
+	MaxSize         int
+	MaxSizePercent  float64
+	OutputFormat    string
+	Quality         int
+	Verbose         bool
+	UploadGravatar  bool
+	Crop            string
+	Focus           string
+	Pad             string
+	CirclePreview   string
+	SafeZone        bool
+	MinSSIM         float64
+	DryRun          bool
+	SVGSize         int
+	Variants        string
+	Srcset          string
+	SrcsetFormats   string
+	Snippet         string
+	URLPrefix       string
+	Alt             string
+	Placeholder     bool
+	Preset          string
+	Profile         string
+	Jobs            int
+	NameTemplate    string
+	SkipUnderCap    bool
+	Manifest        string
+	Resume          string
+	JSON            bool
+	InputName       string
+	DownloadTimeout time.Duration
+	MaxDownload     int
+	Force           bool
+	Backup          bool
 }
 
 // main() - entry point
 func main() {
-	cfg := parseFlags(os.Args[1:])
-	showUsage, err := validateConfig(cfg)
+	if err := run(os.Args[1:]); err != nil {
+		if err != errUsage && err != errReported {
+			fmt.Fprintln(stdout, "Error:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// runCompressCommand() - compress one image as described by the compress flags
+/* args ([]string) - arguments after the subcommand name, or all arguments for the flat invocation */
+func runCompressCommand(args []string) error {
+	cfg, err := parseFlags(args)
+
+	// the redirections below last for this command only
+	defer func(out, log io.Writer) {
+		stdout, compressor.LogOutput, jsonOut = out, log, nil
+	}(stdout, compressor.LogOutput)
+
+	// stdout carries the image, so every message goes to stderr
+	if cfg.OutputPath == stdioPath {
+		stdout = os.Stderr
+		compressor.LogOutput = os.Stderr
+	}
+
+	// -json reports go where the text would, the text moves to stderr
+	if cfg.JSON {
+		jsonOut, stdout, compressor.LogOutput = stdout, os.Stderr, os.Stderr
+	}
+
+	if err == errUsage {
+		return err
+	} else if err != nil {
+		return reportFailure(cfg, withCode(codeInvalidArguments, err))
+	}
+
+	if cfg.InputPath == stdioPath {
+		path, err := spoolStdin()
+		if err != nil {
+			return reportFailure(cfg, withCode(codeInputNotFound, err))
+		}
+		defer os.Remove(path)
+
+		cfg.InputPath, cfg.InputName = path, stdioPath
+	} else if isURL(cfg.InputPath) {
+		path, err := downloadInput(cfg)
+		if err != nil {
+			return reportFailure(cfg, withCode(codeDownloadFailed, err))
+		}
+		defer os.Remove(path)
 
+		cfg.InputPath, cfg.InputName = path, cfg.InputPath
+	}
+
+	showUsage, err := validateConfig(cfg)
 	if showUsage {
-		flag.Usage()
-		os.Exit(1)
+		printCompressUsage()
+		return errUsage
 	}
 
 	if err != nil {
-		fmt.Println("Error:", err)
-		os.Exit(1)
+		return reportFailure(cfg, withCode(codeInvalidArguments, err))
 	}
 
 	if err := runCompress(cfg); err != nil {
-		fmt.Println("Error compressing image:", err)
-		os.Exit(1)
+		if err == errReported {
+			return err
+		}
+		return reportFailure(cfg, fmt.Errorf("compressing image failed: %w", err))
+	}
+
+	if !cfg.DryRun && !isBatchInput(cfg.InputPath) && !cfg.JSON {
+		fmt.Fprintln(stdout, "Image compressed successfully!")
+	}
+
+	return nil
+}
+
+// parseFlags() - extract flags into a Config struct, filling flags not given from presets, config files and GITFIT_* variables
+// (the Config is returned with a settings error too, so -json can report it)
+/* args ([]string) - compress arguments */
+func parseFlags(args []string) (*Config, error) {
+	fs, build := newCompressFlagSet(flag.ContinueOnError)
+
+	// parse errors are printed below, once it is known whether they belong in a -json report
+	usage := fs.Usage
+	fs.Usage = func() {}
+	fs.SetOutput(io.Discard)
+
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		usage()
+		return build(), errUsage
+	} else if err != nil {
+		// parsing stops at the bad flag, so -json may not have been reached yet
+		cfg := build()
+		cfg.JSON = cfg.JSON || wantsJSON(args)
+		if cfg.JSON {
+			return cfg, err
+		}
+
+		fmt.Fprintln(os.Stderr, err)
+		usage()
+		return cfg, errUsage
+	}
+
+	err := applySettings(fs)
+	return build(), err
+}
+
+// wantsJSON() - report whether args ask for -json, looking past flags that failed to parse
+/* args ([]string) - compress arguments */
+func wantsJSON(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "json" {
+			continue
+		}
+
+		on, err := strconv.ParseBool(value)
+		return !hasValue || (err == nil && on)
 	}
 
-	fmt.Println("Image compressed successfully!")
+	return false
 }
 
-// parseFlags() - extract flags into a Config struct
-func parseFlags(args []string) *Config {
-	fs := flag.NewFlagSet("gitfit", flag.ExitOnError)
+// printCompressUsage() - print the usage of the compress command
+func printCompressUsage() {
+	fs, _ := newCompressFlagSet(flag.ContinueOnError)
+	fs.Usage()
+}
+
+// newCompressFlagSet() - define the compress flags, returns the flag set and a function building the Config from it
+/* errorHandling (flag.ErrorHandling) - what Parse does on a bad flag */
+func newCompressFlagSet(errorHandling flag.ErrorHandling) (*flag.FlagSet, func() *Config) {
+	fs := flag.NewFlagSet("compress", errorHandling)
 
 	// define command-line flags
-	inputPath := fs.String("input", "", "Path to the input image file")
-	outputPath := fs.String("output", "", "Path to save the compressed image")
-	maxSize := fs.Int("maxsize", 1048576, "Maximum file size in bytes (default 1MB)")
-	outputFormat := fs.String("format", "", "Output image format (jpeg, png, or gif)")
+	inputPath := fs.String("input", "", "Path to the input image file, an http(s) URL, a directory or quoted glob to compress many, or - for stdin")
+	outputPath := fs.String("output", "", "Path to save the compressed image, or - for stdout")
+	maxSize, maxSizePercent := 1048576, 0.0
+	fs.Var(&sizeFlag{bytes: &maxSize, percent: &maxSizePercent}, "maxsize", "Maximum file `size`: bytes, a unit such as 500KB, 1MiB or 750k, or a share of the input such as 50%")
+	outputFormat := fs.String("format", "", "Output image format ("+strings.Join(compressor.FormatNames(), ", ")+")")
 	quality := fs.Int("quality", 85, "JPEG compression quality (1-100; 85 by default)")
+	minSSIM := fs.Float64("min-ssim", 0, "Find the smallest output whose SSIM against the input is at least this value (0-1; off by default)")
 	verbose := fs.Bool("v", false, "Verbose logging enabled")
-	uploadGravatar := fs.Bool("upload-gravatar", false, "Upload compressed image to Gravatar")
+	dryRun := fs.Bool("dry-run", false, "Show the width, quality and size that would be produced without writing files")
+	svgSize := fs.Int("svg-size", 0, fmt.Sprintf("Rasterize SVG input with this many pixels on the longest side (default %d, then sized down to fit -maxsize)", compressor.DefaultSVGSize))
+	variants := fs.String("variants", "", "Write several sizes into the -output directory: size[:format[:maxbytes]],... or 'default' for 32,64,128,256,512")
+	srcset := fs.String("srcset", "", "Write a width ladder for responsive images into the -output directory: w1,w2,... or 'default' for 320,640,960,1280,1920")
+	srcsetFormats := fs.String("srcset-formats", "", "Formats for -srcset in order of preference, the last one is the <img> fallback (default -format)")
+	snippet := fs.String("snippet", "html", "Snippet printed for -srcset: html or markdown")
+	urlPrefix := fs.String("url-prefix", "", "Prefix for file references in the -srcset snippet, e.g. /images/")
+	alt := fs.String("alt", "", "Alternative text for the -srcset snippet")
+	placeholder := fs.Bool("placeholder", false, "Print a BlurHash and ThumbHash of the output to show while the image loads")
+	jobs := fs.Int("jobs", runtime.NumCPU(), "Number of images compressed at once when -input is a directory or glob")
+	nameTemplate := fs.String("name", defaultNameTemplate, "Output name for directory or glob input; {name}, {ext}, {format}, {width}, {height} and {quality} are filled in")
+	manifestPath := fs.String("manifest", "", "With directory or glob input, record every input and its outcome in this .json or .csv file")
+	resume := fs.String("resume", "", "With directory or glob input, skip inputs this manifest shows as done with the same settings")
+	skipUnderCap := fs.Bool("skip-under-cap", false, "With directory or glob input, leave images already under -maxsize alone")
+	force := fs.Bool("force", false, "Overwrite the output file if it already exists")
+	backup := fs.Bool("backup", false, "Keep an existing output file as <output>.bak before overwriting it")
+	uploadGravatar := fs.Bool("upload-gravatar", false, "Upload compressed image to Gravatar (same as running 'gitfit upload gravatar' on the output)")
+	preset := fs.String("preset", "", "Start from a named preset, flags given explicitly still win (see 'gitfit presets')")
+	profile := fs.String("profile", "", "Apply a profile from the config files (see 'gitfit config show')")
+	crop := fs.String("crop", "", "Crop to a square before compressing (center, smart, or x,y,w,h for a manual region)")
+	focus := fs.String("focus", "", "Center the square crop on x,y given as fractions of the image size (e.g. 0.5,0.3)")
+	pad := fs.String("pad", "", "Pad to a square instead of cropping; background is blur, white, black, transparent, or a hex color")
+	circlePreview := fs.String("circle-preview", "", "Write a PNG preview of the output with the circular avatar mask applied")
+	safeZone := fs.Bool("safezone", false, "Warn when a circular avatar mask would hide a lot of detail (on with the gravatar and github presets and -upload-gravatar)")
+	downloadTimeout := fs.Duration("download-timeout", 30*time.Second, "Give up on a URL -input after this long")
+	maxDownload := defaultMaxDownload
+	fs.Var(&sizeFlag{bytes: &maxDownload, percent: new(float64)}, "max-download", "Largest URL -input accepted (`size`, e.g. 20MB)")
+	asJSON := fs.Bool("json", false, "Print the result as a JSON object instead of text, one object per line for directory or glob input")
 
 	// custom usage message for flags
 	fs.Usage = func() {
-		fmt.Println("Usage: gitfit -input <input-image-file> -output <output-image-file> -maxsize <max size in bytes> " +
-			"-format <jpeg|png|gif> -quality <0-100> -v [for verbose logging] -upload-gravatar [to upload to Gravatar]")
-		fmt.Println("Example: gitfit -input input.jpeg -output output.jpeg -maxsize 1000000 -format jpeg -quality 85 -v -upload-gravatar")
-		fmt.Println("Flags:")
+		fmt.Fprintln(stdout, "Usage: gitfit compress -input <input-image-file> -output <output-image-file> -maxsize <bytes|500KB|1MiB|50%> "+
+			"-format <"+strings.Join(compressor.FormatNames(), "|")+"> -quality <0-100> -min-ssim <0-1> -crop <center|smart|x,y,w,h> -focus <x,y> "+
+			"-pad <blur|color> -circle-preview <preview.png> -safezone -svg-size <pixels> -variants <list> -srcset <widths> -srcset-formats <list> -snippet <html|markdown> -url-prefix <prefix> -alt <text> -placeholder -preset <name> -profile <name> -jobs <n> -name <template> -skip-under-cap -manifest <file> -resume <file> -dry-run -json -force -backup -v [for verbose logging] -upload-gravatar [to upload to Gravatar]")
+		fmt.Fprintln(stdout, "Example: gitfit compress -input input.jpeg -output output.jpeg -maxsize 1MB -format jpeg -quality 85 -v")
+		fmt.Fprintln(stdout, "Pipe:  curl -s https://example.com/me.png | gitfit compress -input - -output - -format jpeg > me.jpg")
+		fmt.Fprintln(stdout, "Batch: gitfit compress -input 'photos/*.jpg' -output out/ -name '{name}_{width}.{ext}' -jobs 4")
+		fmt.Fprintln(stdout, "The compress command name is optional: 'gitfit -input ...' works the same.")
+		fmt.Fprintln(stdout, "Flags:")
 		fs.PrintDefaults()
 	}
 
-	fs.Parse(args)
-
-	return &Config{
-		InputPath:      *inputPath,
-		OutputPath:     *outputPath,
-		MaxSize:        *maxSize,
-		OutputFormat:   *outputFormat,
-		Quality:        *quality,
-		Verbose:        *verbose,
-		UploadGravatar: *uploadGravatar,
+	return fs, func() *Config {
+		return &Config{
+			InputPath:       *inputPath,
+			OutputPath:      *outputPath,
+			MaxSize:         maxSize,
+			MaxSizePercent:  maxSizePercent,
+			OutputFormat:    *outputFormat,
+			Quality:         *quality,
+			Verbose:         *verbose,
+			UploadGravatar:  *uploadGravatar,
+			Crop:            *crop,
+			Focus:           *focus,
+			Pad:             *pad,
+			CirclePreview:   *circlePreview,
+			SafeZone:        *safeZone,
+			MinSSIM:         *minSSIM,
+			DryRun:          *dryRun,
+			SVGSize:         *svgSize,
+			Variants:        *variants,
+			Srcset:          *srcset,
+			SrcsetFormats:   *srcsetFormats,
+			Snippet:         *snippet,
+			URLPrefix:       *urlPrefix,
+			Alt:             *alt,
+			Placeholder:     *placeholder,
+			Preset:          *preset,
+			Profile:         *profile,
+			Jobs:            *jobs,
+			NameTemplate:    *nameTemplate,
+			SkipUnderCap:    *skipUnderCap,
+			Manifest:        *manifestPath,
+			Resume:          *resume,
+			JSON:            *asJSON,
+			DownloadTimeout: *downloadTimeout,
+			MaxDownload:     maxDownload,
+			Force:           *force,
+			Backup:          *backup,
+		}
 	}
 }
 
 // validateConfig() - perform validations and sets defaults, returns if usage should be shown
 /* cfg (*Config) - configuration to validate */
 func validateConfig(cfg *Config) (bool, error) {
-	// check if input and/or output path is missing
-	if cfg.InputPath == "" || cfg.OutputPath == "" {
+	// check if input and/or output path is missing (a dry run writes nothing, so it needs no output)
+	if cfg.InputPath == "" || (cfg.OutputPath == "" && !cfg.DryRun) {
 		if cfg.InputPath == "" && cfg.OutputPath == "" {
 			return true, nil
 		}
@@ -95,26 +326,80 @@ func validateConfig(cfg *Config) (bool, error) {
 		return false, fmt.Errorf("you must provide both -input and -output file paths")
 	}
 
-	if _, err := os.Stat(cfg.InputPath); os.IsNotExist(err) {
-		return false, fmt.Errorf("input file %s does not exist", cfg.InputPath)
+	if cfg.Preset != "" {
+		if _, ok := lookupPreset(cfg.Preset); !ok {
+			return false, fmt.Errorf("unknown preset %q, run 'gitfit presets' to list them", cfg.Preset)
+		}
 	}
 
-	// set default output format based on input file extension if not provided
-	if cfg.OutputFormat == "" {
-		extension := strings.ToLower(filepath.Ext(cfg.InputPath))
-		switch extension {
-		case ".jpg", ".jpeg":
-			cfg.OutputFormat = "jpeg"
-		case ".png":
-			cfg.OutputFormat = "png"
-		case ".gif":
-			cfg.OutputFormat = "gif"
-		default:
-			return false, fmt.Errorf("unsupported input file extension: %s. Please specify format explicitly", extension)
+	// a directory or glob input compresses every matching image into the -output directory
+	batch := isBatchInput(cfg.InputPath)
+	if batch {
+		if err := validateBatch(cfg); err != nil {
+			return false, err
 		}
+	} else if info, err := os.Stat(cfg.InputPath); os.IsNotExist(err) {
+		return false, withCode(codeInputNotFound, fmt.Errorf("input file %s does not exist", cfg.InputPath))
+	} else if err == nil && cfg.MaxSizePercent > 0 {
+		// a relative -maxsize is a share of this input, batch runs resolve it per file
+		cfg.MaxSize = compressor.Size{Percent: cfg.MaxSizePercent}.Resolve(info.Size())
+
+		if cfg.Verbose {
+			fmt.Fprintf(stdout, "Max size: %g%% of %d bytes = %d bytes\n", cfg.MaxSizePercent, info.Size(), cfg.MaxSize)
+		}
+	}
+
+	if cfg.OutputPath == stdioPath && (batch || cfg.Variants != "" || cfg.Srcset != "" || cfg.UploadGravatar || cfg.CirclePreview != "" || cfg.Backup) {
+		return false, fmt.Errorf("-output - writes one image to stdout and cannot be combined with directory or glob input, -variants, -srcset, -upload-gravatar, -circle-preview or -backup")
+	}
+
+	if !batch && (cfg.Manifest != "" || cfg.Resume != "") {
+		return false, fmt.Errorf("-manifest and -resume need a directory or glob -input")
+	}
+
+	if cfg.JSON && (cfg.Variants != "" || cfg.Srcset != "") {
+		return false, fmt.Errorf("-json cannot be combined with -variants or -srcset")
+	}
+
+	if cfg.Variants != "" && cfg.Srcset != "" {
+		return false, fmt.Errorf("-variants and -srcset cannot be combined")
 	}
 
-	if cfg.MaxSize <= 0 {
+	if cfg.Variants != "" || cfg.Srcset != "" {
+		if info, err := os.Stat(cfg.OutputPath); err == nil && !info.IsDir() {
+			return false, fmt.Errorf("-output must be a directory when -variants or -srcset is used")
+		}
+
+		if cfg.UploadGravatar || cfg.CirclePreview != "" || cfg.MinSSIM > 0 {
+			return false, fmt.Errorf("-variants and -srcset cannot be combined with -upload-gravatar, -circle-preview or -min-ssim")
+		}
+	} else if !batch {
+		if err := checkOverwrite(cfg); err != nil {
+			return false, err
+		}
+	}
+
+	// set default output format from the input's content, or its extension when the content is not recognized
+	// (batch runs pick it per file)
+	if cfg.OutputFormat == "" && !batch {
+		format, err := defaultFormat(cfg.InputPath)
+		if err != nil {
+			return false, err
+		}
+		cfg.OutputFormat = format
+	}
+
+	if cfg.OutputFormat != "" {
+		enc, ok := compressor.LookupEncoder(cfg.OutputFormat)
+		if !ok {
+			return false, fmt.Errorf("unsupported output format: %s. Supported formats are: %s",
+				cfg.OutputFormat, strings.Join(compressor.FormatNames(), ", "))
+		}
+		cfg.OutputFormat = enc.Name()
+	}
+
+	// a percentage cap is resolved per file once its size is known
+	if cfg.MaxSize <= 0 && cfg.MaxSizePercent <= 0 {
 		return false, fmt.Errorf("max size must be greater than 0")
 	}
 
@@ -122,59 +407,492 @@ func validateConfig(cfg *Config) (bool, error) {
 		return false, fmt.Errorf("value for -quality must be between 1 and 100 inclusive")
 	}
 
+	if cfg.MinSSIM < 0 || cfg.MinSSIM > 1 {
+		return false, fmt.Errorf("value for -min-ssim must be between 0 and 1")
+	}
+
+	if cfg.SVGSize < 0 || cfg.SVGSize > compressor.MaxSVGSize {
+		return false, fmt.Errorf("value for -svg-size must be between 0 and %d", compressor.MaxSVGSize)
+	}
+
+	opts, err := compressOptions(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	// batch runs pick the format per file, so Compress repeats this check
+	if err := compressor.CheckPadAlpha(opts.Crop, cfg.OutputFormat); err != nil {
+		return false, fmt.Errorf("value for -pad is invalid: %v", err)
+	}
+
+	if cfg.Srcset != "" {
+		if _, err := compressor.ParseWidths(cfg.Srcset); err != nil {
+			return false, fmt.Errorf("value for -srcset is invalid: %v", err)
+		}
+
+		formats, err := compressor.ParseFormats(cfg.SrcsetFormats, cfg.OutputFormat)
+		if err != nil {
+			return false, fmt.Errorf("value for -srcset-formats is invalid: %v", err)
+		}
+
+		if err := compressor.CheckPadAlpha(opts.Crop, formats...); err != nil {
+			return false, fmt.Errorf("value for -pad is invalid: %v", err)
+		}
+
+		if cfg.Snippet != "html" && cfg.Snippet != "markdown" {
+			return false, fmt.Errorf("value for -snippet must be html or markdown")
+		}
+	}
+
+	if cfg.Variants != "" {
+		specs, err := compressor.ParseVariants(cfg.Variants, cfg.OutputFormat, cfg.MaxSize)
+		if err != nil {
+			return false, fmt.Errorf("value for -variants is invalid: %v", err)
+		}
+
+		for _, spec := range specs {
+			if err := compressor.CheckPadAlpha(opts.Crop, spec.Format); err != nil {
+				return false, fmt.Errorf("value for -pad is invalid: %v", err)
+			}
+		}
+	}
+
 	return false, nil
 }
 
+// sizeFlag is a flag.Value for -maxsize that accepts units and percentages
+/* bytes (*int) - receives absolute sizes; percent (*float64) - receives shares of the input size */
+type sizeFlag struct {
+	bytes   *int
+	percent *float64
+}
+
+// String() - format the current value for -h
+// f (*sizeFlag) - flag value
+func (f *sizeFlag) String() string {
+	if f.bytes == nil {
+		return ""
+	}
+
+	return compressor.Size{Bytes: *f.bytes, Percent: *f.percent}.String()
+}
+
+// Set() - parse a -maxsize value
+// f (*sizeFlag) - flag value
+func (f *sizeFlag) Set(value string) error {
+	size, err := compressor.ParseSize(value)
+	if err != nil {
+		return err
+	}
+
+	*f.bytes, *f.percent = size.Bytes, size.Percent
+	return nil
+}
+
+// defaultFormat() - choose an output format for inputPath by sniffing its content, falling back to the extension
+/* inputPath (string) - path of the input image */
+func defaultFormat(inputPath string) (string, error) {
+	if detected, err := compressor.DetectFormat(inputPath); err == nil {
+		if format, ok := compressor.DefaultOutputFormat(detected); ok {
+			return format, nil
+		}
+	}
+
+	extension := strings.ToLower(filepath.Ext(inputPath))
+	enc, ok := compressor.EncoderForExtension(extension)
+	if !ok {
+		return "", fmt.Errorf("unsupported input file extension: %s. Please specify format explicitly", extension)
+	}
+
+	return enc.Name(), nil
+}
+
+// checkOverwrite() - refuse to replace an existing output file or circle preview unless -force or -backup is given
+/* cfg (*Config) - configuration to check */
+func checkOverwrite(cfg *Config) error {
+	// the preview is written after the output, so sharing a path would replace the image just compressed
+	if cfg.CirclePreview != "" && filepath.Clean(cfg.CirclePreview) == filepath.Clean(cfg.OutputPath) {
+		return fmt.Errorf("-circle-preview must be a different file than -output")
+	}
+
+	if cfg.DryRun || cfg.Force || cfg.Backup || cfg.OutputPath == stdioPath {
+		return nil
+	}
+
+	if sameFile(cfg.InputPath, cfg.OutputPath) {
+		return withCode(codeOutputExists, fmt.Errorf("output %s is the input file; use -force to replace it or -backup to keep a copy", cfg.OutputPath))
+	}
+
+	if _, err := os.Stat(cfg.OutputPath); err == nil {
+		return withCode(codeOutputExists, fmt.Errorf("output file %s already exists; use -force to overwrite it or -backup to keep a copy", cfg.OutputPath))
+	}
+
+	if cfg.CirclePreview == "" {
+		return nil
+	}
+
+	if sameFile(cfg.InputPath, cfg.CirclePreview) {
+		return withCode(codeOutputExists, fmt.Errorf("circle preview %s is the input file; use -force to replace it or -backup to keep a copy", cfg.CirclePreview))
+	}
+
+	if _, err := os.Stat(cfg.CirclePreview); err == nil {
+		return withCode(codeOutputExists, fmt.Errorf("circle preview %s already exists; use -force to overwrite it or -backup to keep a copy", cfg.CirclePreview))
+	}
+
+	return nil
+}
+
+// sameFile() - report whether two paths refer to the same existing file
+/* a (string) - first path; b (string) - second path */
+func sameFile(a, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(infoA, infoB)
+}
+
+// compressOptions() - translate the Config into compressor options
+/* cfg (*Config) - configuration for compression */
+func compressOptions(cfg *Config) (compressor.Options, error) {
+	crop, err := compressor.ParseCrop(cfg.Crop)
+	if err != nil {
+		return compressor.Options{}, fmt.Errorf("value for -crop is invalid: %v", err)
+	}
+
+	crop.Focus, err = compressor.ParseFocus(cfg.Focus)
+	if err != nil {
+		return compressor.Options{}, fmt.Errorf("value for -focus is invalid: %v", err)
+	}
+
+	if cfg.Pad != "" {
+		if cfg.Crop != "" || cfg.Focus != "" {
+			return compressor.Options{}, fmt.Errorf("-pad cannot be combined with -crop or -focus")
+		}
+
+		bg, err := compressor.ParsePadBackground(cfg.Pad)
+		if err != nil {
+			return compressor.Options{}, fmt.Errorf("value for -pad is invalid: %v", err)
+		}
+
+		crop = compressor.CropSpec{Mode: compressor.CropPad, Pad: bg}
+	}
+
+	return compressor.Options{
+		MaxSize:      cfg.MaxSize,
+		OutputFormat: cfg.OutputFormat,
+		Quality:      cfg.Quality,
+		Verbose:      cfg.Verbose,
+		Crop:         crop,
+		MinSSIM:      cfg.MinSSIM,
+		DryRun:       cfg.DryRun,
+		SVGSize:      cfg.SVGSize,
+		Placeholder:  cfg.Placeholder,
+		SafeZone:     cfg.SafeZone || cfg.UploadGravatar,
+	}, nil
+}
+
 // runCompress() - call the compressor with the provided Config
 /* cfg (*Config) - configuration for compression */
 func runCompress(cfg *Config) error {
-	err := compressor.CompressImage(cfg.InputPath, cfg.OutputPath, cfg.MaxSize,
-		cfg.OutputFormat, cfg.Quality, cfg.Verbose)
+	if isBatchInput(cfg.InputPath) {
+		return runBatch(cfg)
+	}
+
+	if cfg.Variants != "" {
+		return runVariants(cfg)
+	}
+
+	if cfg.Srcset != "" {
+		return runSrcset(cfg)
+	}
+
+	opts, err := compressOptions(cfg)
 	if err != nil {
 		return err
 	}
 
-	if cfg.UploadGravatar {
-		if cfg.Verbose {
-			fmt.Println("Uploading to Gravatar...")
+	if cfg.Backup && !cfg.DryRun {
+		for _, path := range []string{cfg.OutputPath, cfg.CirclePreview} {
+			if path == "" {
+				continue
+			}
+
+			if _, err := os.Stat(path); err == nil {
+				backupPath, err := compressor.BackupFile(path)
+				if err != nil {
+					return err
+				}
+
+				if cfg.Verbose {
+					fmt.Fprintf(stdout, "Existing %s backed up to %s\n", path, backupPath)
+				}
+			}
+		}
+	}
+
+	// for -output - compress into a temp file and stream it once it is complete
+	outputPath := cfg.OutputPath
+	if outputPath == stdioPath && !cfg.DryRun {
+		tmp, err := os.CreateTemp("", "gitfit-out-*")
+		if err != nil {
+			return err
 		}
+		tmp.Close()
+		defer os.Remove(tmp.Name())
+
+		outputPath = tmp.Name()
+	}
+
+	start := time.Now()
+	result, err := compressor.Compress(cfg.InputPath, outputPath, opts)
+	if err != nil {
+		return err
+	}
 
-		// load OAuth credentials from environment
-		clientID := os.Getenv("GRAVATAR_CLIENT_ID")
-		clientSecret := os.Getenv("GRAVATAR_CLIENT_SECRET")
-		redirectURI := os.Getenv("GRAVATAR_REDIRECT_URI")
+	report := newReport(inputName(cfg), cfg.OutputPath, cfg.InputPath, result, cfg.DryRun, time.Since(start))
 
-		if clientID == "" || clientSecret == "" {
-			return fmt.Errorf("GRAVATAR_CLIENT_ID and GRAVATAR_CLIENT_SECRET environment variables must be set")
+	if !cfg.JSON {
+		for _, warning := range result.Warnings {
+			fmt.Fprintln(stdout, "Warning:", warning)
 		}
+	}
 
-		// use default redirect URI if not specified
-		if redirectURI == "" {
-			redirectURI = "http://localhost:8080/callback"
+	if cfg.DryRun {
+		if cfg.JSON {
+			return writeReport(report)
 		}
 
-		// create OAuth client
-		client := gravatar.NewClient(clientID, clientSecret, redirectURI, cfg.Verbose)
+		printPlan(result)
+		return nil
+	}
+
+	if cfg.OutputPath == stdioPath {
+		if err := writeImageOut(outputPath); err != nil {
+			return err
+		}
+	}
+
+	if result.Placeholder != nil && !cfg.JSON {
+		printPlaceholder(stdout, result.Placeholder)
+	}
+
+	if cfg.CirclePreview != "" {
+		if err := compressor.SaveCirclePreview(cfg.OutputPath, cfg.CirclePreview); err != nil {
+			return fmt.Errorf("failed to write circle preview: %v", err)
+		}
 
-		// perform OAuth authentication
 		if cfg.Verbose {
-			fmt.Println("Starting OAuth authentication...")
-			fmt.Println("Your browser will open for authorization.")
+			fmt.Fprintln(stdout, "Circle preview written to", cfg.CirclePreview)
 		}
+	}
+
+	if cfg.UploadGravatar {
+		err := uploadOutput(cfg)
+		if !cfg.JSON {
+			return err
+		}
+
+		// the image is written either way, so the report still carries the result
+		report.Gravatar = &gravatarReport{Uploaded: err == nil}
+		if err != nil {
+			report.Status, report.Gravatar.Error = "error", err.Error()
+			report.Error = &errorReport{Code: codeUploadFailed, Message: err.Error()}
+		}
+	}
 
-		if err := client.Authenticate(); err != nil {
-			return fmt.Errorf("OAuth authentication failed: %v", err)
+	if cfg.JSON {
+		if err := writeReport(report); err != nil {
+			return err
 		}
 
-		// upload avatar
-		if err := client.UploadAvatar(cfg.OutputPath); err != nil {
-			return fmt.Errorf("failed to upload to Gravatar: %v", err)
+		if report.Error != nil {
+			return errReported
+		}
+	}
+
+	return nil
+}
+
+// uploadOutput() - set the compressed output as the Gravatar avatar
+/* cfg (*Config) - configuration for compression */
+func uploadOutput(cfg *Config) error {
+	if cfg.Verbose {
+		fmt.Fprintln(stdout, "Uploading to Gravatar...")
+	}
+
+	// reuse the login saved by 'gitfit auth login', or sign in now
+	client, err := gravatarClient(cfg.Verbose)
+	if err != nil {
+		return withCode(codeUploadFailed, err)
+	}
+
+	// upload avatar
+	if err := client.UploadAvatar(cfg.OutputPath); err != nil {
+		return withCode(codeUploadFailed, fmt.Errorf("failed to upload to Gravatar: %v", err))
+	}
+
+	if cfg.Verbose {
+		fmt.Fprintln(stdout, "Successfully uploaded to Gravatar!")
+	}
+
+	return nil
+}
+
+// runVariants() - write every requested variant of the input into the output directory
+/* cfg (*Config) - configuration for compression */
+func runVariants(cfg *Config) error {
+	opts, err := compressOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	specs, err := compressor.ParseVariants(cfg.Variants, cfg.OutputFormat, cfg.MaxSize)
+	if err != nil {
+		return err
+	}
+
+	variants, err := compressor.CompressVariants(cfg.InputPath, specs, opts)
+	if err != nil {
+		return err
+	}
+
+	base := filepath.Base(cfg.InputPath)
+	paths := make([]string, len(variants))
+	for i, v := range variants {
+		paths[i] = filepath.Join(cfg.OutputPath, v.Filename(base))
+	}
+
+	if cfg.DryRun {
+		fmt.Fprintln(stdout, "Dry run, no files written.")
+		for i, v := range variants {
+			fmt.Fprintf(stdout, "%s: %dx%d %s, %d bytes (budget %d)\n", paths[i], v.Width, v.Height, v.Spec.Format, len(v.Data), v.Spec.MaxSize)
+		}
+		return nil
+	}
+
+	data := make([][]byte, len(variants))
+	for i, v := range variants {
+		data[i] = v.Data
+
+		for _, warning := range v.Warnings {
+			fmt.Fprintf(stdout, "Warning: %s: %s\n", paths[i], warning)
+		}
+	}
+
+	return writeOutputs(cfg, paths, data)
+}
+
+// runSrcset() - write a responsive width ladder into the output directory and print a snippet referencing it
+/* cfg (*Config) - configuration for compression */
+func runSrcset(cfg *Config) error {
+	opts, err := compressOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	widths, err := compressor.ParseWidths(cfg.Srcset)
+	if err != nil {
+		return err
+	}
+
+	formats, err := compressor.ParseFormats(cfg.SrcsetFormats, cfg.OutputFormat)
+	if err != nil {
+		return err
+	}
+
+	set, err := compressor.CompressSrcset(cfg.InputPath, widths, formats, opts)
+	if err != nil {
+		return err
+	}
+
+	base := filepath.Base(cfg.InputPath)
+	paths := make([]string, len(set.Images))
+	data := make([][]byte, len(set.Images))
+	for i, img := range set.Images {
+		paths[i] = filepath.Join(cfg.OutputPath, img.Filename(base))
+		data[i] = img.Data
+	}
+
+	if cfg.DryRun {
+		fmt.Fprintln(stdout, "Dry run, no files written.")
+		for i, img := range set.Images {
+			fmt.Fprintf(stdout, "%s: %dx%d %s, %d bytes\n", paths[i], img.Width, img.Height, img.Format, len(img.Data))
+		}
+		return nil
+	}
+
+	if err := writeOutputs(cfg, paths, data); err != nil {
+		return err
+	}
+
+	if cfg.Snippet == "markdown" {
+		fmt.Fprint(stdout, set.Markdown(base, cfg.URLPrefix, cfg.Alt))
+	} else {
+		fmt.Fprint(stdout, set.HTML(base, cfg.URLPrefix, cfg.Alt))
+	}
+
+	return nil
+}
+
+// writeOutputs() - atomically write a set of files into the output directory, honoring -force and -backup
+/* cfg (*Config) - configuration for compression; paths ([]string) - destination of each file; data ([][]byte) - file contents */
+func writeOutputs(cfg *Config, paths []string, data [][]byte) error {
+	// refuse before writing anything so a run never leaves a partial set behind
+	if !cfg.Force && !cfg.Backup {
+		for _, path := range paths {
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("output file %s already exists; use -force to overwrite it or -backup to keep a copy", path)
+			}
+		}
+	}
+
+	if err := os.MkdirAll(cfg.OutputPath, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	for i, path := range paths {
+		if cfg.Backup {
+			if _, err := os.Stat(path); err == nil {
+				if _, err := compressor.BackupFile(path); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := compressor.WriteFileAtomic(path, data[i]); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
 		}
 
 		if cfg.Verbose {
-			fmt.Println("Successfully uploaded to Gravatar!")
+			fmt.Fprintf(stdout, "Wrote %s (%.2f KB)\n", path, float64(len(data[i]))/1024.0)
 		}
 	}
 
 	return nil
 }
+
+// printPlan() - print the outcome of a dry run
+/* result (*compressor.Result) - planned result */
+func printPlan(result *compressor.Result) {
+	status := "reachable"
+	if !result.Reachable {
+		status = "NOT reachable (closest attempt shown)"
+	}
+
+	fmt.Fprintln(stdout, "Dry run, no files written.")
+	fmt.Fprintf(stdout, "Target: %s\n", status)
+	fmt.Fprintf(stdout, "Output: %dx%d %s at quality %d\n", result.Width, result.Height, result.Format, result.Quality)
+	fmt.Fprintf(stdout, "Projected size: %d bytes (%.2f KB)\n", result.Size, float64(result.Size)/1024.0)
+	fmt.Fprintf(stdout, "SSIM: %.4f, PSNR: %.2f dB\n", result.SSIM, result.PSNR)
+
+	if result.Placeholder != nil {
+		printPlaceholder(stdout, result.Placeholder)
+	}
+}
@@ -1,14 +1,64 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"image"
 	"image/color"
 	"image/jpeg"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/nabiladem/git-fit/internal/compressor"
+	"github.com/nabiladem/git-fit/internal/gravatar"
 )
 
+// TestMain() - run the package tests away from the developer's own config: an empty config directory,
+// a temp working directory with no .gitfit.* file above it, and no GITFIT_* variables
+/* m (*testing.M) - test runner */
+func TestMain(m *testing.M) {
+	os.Exit(runIsolated(m))
+}
+
+// runIsolated() - set up the isolated environment, run the tests and clean up, returns the exit code
+/* m (*testing.M) - test runner */
+func runIsolated(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "gitfit-test-*")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	userConfigDir = func() (string, error) { return filepath.Join(dir, "config"), nil }
+
+	work := filepath.Join(dir, "work")
+	if err := os.Mkdir(work, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := os.Chdir(work); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, envPrefix) {
+			os.Unsetenv(name)
+		}
+	}
+
+	return m.Run()
+}
+
 // TestParseFlags() - tests the parseFlags function
 func TestParseFlags(t *testing.T) {
 	tests := []struct {
@@ -49,7 +99,7 @@ func TestParseFlags(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			cfg := parseFlags(tt.args)
+			cfg := mustParseFlags(t, tt.args)
 			if cfg.InputPath != tt.expected.InputPath {
 				t.Errorf("expected InputPath %s, got %s", tt.expected.InputPath, cfg.InputPath)
 			}
@@ -149,6 +199,68 @@ func TestValidateConfig(t *testing.T) {
 			wantUsage: false,
 			wantErr:   true,
 		},
+		{
+			name: "Pad With Crop",
+			cfg: Config{
+				InputPath:  tmpFile.Name(),
+				OutputPath: "out.jpg",
+				MaxSize:    100,
+				Quality:    80,
+				Crop:       "center",
+				Pad:        "blur",
+			},
+			wantUsage: false,
+			wantErr:   true,
+		},
+		{
+			name: "Transparent Pad As JPEG",
+			cfg: Config{
+				InputPath:    tmpFile.Name(),
+				OutputPath:   "out.jpg",
+				OutputFormat: "jpeg",
+				MaxSize:      100,
+				Quality:      80,
+				Pad:          "transparent",
+			},
+			wantUsage: false,
+			wantErr:   true,
+		},
+		{
+			name: "Transparent Pad As PNG",
+			cfg: Config{
+				InputPath:    tmpFile.Name(),
+				OutputPath:   "out.png",
+				OutputFormat: "png",
+				MaxSize:      100,
+				Quality:      80,
+				Pad:          "transparent",
+			},
+			wantUsage: false,
+			wantErr:   false,
+		},
+		{
+			name: "Output Is Input",
+			cfg: Config{
+				InputPath:  tmpFile.Name(),
+				OutputPath: tmpFile.Name(),
+				MaxSize:    100,
+				Quality:    80,
+			},
+			wantUsage: false,
+			wantErr:   true,
+		},
+		{
+			name: "Output Is Input With Force",
+			cfg: Config{
+				InputPath:  tmpFile.Name(),
+				OutputPath: tmpFile.Name(),
+				MaxSize:    100,
+				Quality:    80,
+				Force:      true,
+			},
+			wantUsage: false,
+			wantErr:   false,
+		},
 		{
 			name: "Valid Config (Auto Format)",
 			cfg: Config{
@@ -237,6 +349,18 @@ func TestRunCompress(t *testing.T) {
 	}
 }
 
+// mustParseFlags() - parse compress flags, failing the test on a config error
+func mustParseFlags(t *testing.T, args []string) *Config {
+	t.Helper()
+
+	cfg, err := parseFlags(args)
+	if err != nil {
+		t.Fatalf("parseFlags failed: %v", err)
+	}
+
+	return cfg
+}
+
 func createTestImage(path string, width, height int, format string) error {
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
 	for y := 0; y < height; y++ {
@@ -268,3 +392,1063 @@ func TestRunCompress_InvalidFile(t *testing.T) {
 		t.Error("expected error for nonexistent input file")
 	}
 }
+
+// TestRunCompress_DryRun() - tests that a dry run validates without an output path and writes nothing
+func TestRunCompress_DryRun(t *testing.T) {
+	inPath := filepath.Join(t.TempDir(), "in.jpg")
+	if err := createTestImage(inPath, 120, 120, "jpg"); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+
+	cfg := &Config{
+		InputPath: inPath,
+		MaxSize:   1024 * 1024,
+		Quality:   80,
+		DryRun:    true,
+	}
+
+	if showUsage, err := validateConfig(cfg); showUsage || err != nil {
+		t.Fatalf("expected dry run config to be valid, got usage %v, err %v", showUsage, err)
+	}
+
+	if err := runCompress(cfg); err != nil {
+		t.Fatalf("runCompress failed: %v", err)
+	}
+}
+
+// TestRunCompress_Backup() - tests that -backup keeps the previous output next to the new one
+func TestRunCompress_Backup(t *testing.T) {
+	td := t.TempDir()
+	inPath := filepath.Join(td, "in.jpg")
+	outPath := filepath.Join(td, "out.jpg")
+
+	if err := createTestImage(inPath, 120, 120, "jpg"); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+
+	if err := os.WriteFile(outPath, []byte("previous"), 0644); err != nil {
+		t.Fatalf("failed to create existing output: %v", err)
+	}
+
+	cfg := &Config{
+		InputPath:  inPath,
+		OutputPath: outPath,
+		MaxSize:    1024 * 1024,
+		Quality:    80,
+	}
+
+	if _, err := validateConfig(cfg); err == nil {
+		t.Fatal("expected error for existing output without -force or -backup")
+	}
+
+	cfg.Backup = true
+	if _, err := validateConfig(cfg); err != nil {
+		t.Fatalf("expected -backup to allow overwriting, got %v", err)
+	}
+
+	if err := runCompress(cfg); err != nil {
+		t.Fatalf("runCompress failed: %v", err)
+	}
+
+	backup, err := os.ReadFile(outPath + ".bak")
+	if err != nil || string(backup) != "previous" {
+		t.Errorf("expected backup with previous contents, got %q (%v)", backup, err)
+	}
+
+	if info, err := os.Stat(outPath); err != nil || info.Size() == 0 {
+		t.Errorf("expected new output to be written, got %v", err)
+	}
+}
+
+// TestRunCompress_CirclePreviewOverwrite() - tests that -circle-preview is guarded like the main output
+func TestRunCompress_CirclePreviewOverwrite(t *testing.T) {
+	td := t.TempDir()
+	inPath := filepath.Join(td, "in.jpg")
+	outPath := filepath.Join(td, "out.jpg")
+	previewPath := filepath.Join(td, "preview.png")
+
+	if err := createTestImage(inPath, 120, 120, "jpg"); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+
+	if err := os.WriteFile(previewPath, []byte("previous"), 0644); err != nil {
+		t.Fatalf("failed to create existing preview: %v", err)
+	}
+
+	cfg := &Config{
+		InputPath:     inPath,
+		OutputPath:    outPath,
+		CirclePreview: previewPath,
+		MaxSize:       1024 * 1024,
+		Quality:       80,
+	}
+
+	if _, err := validateConfig(cfg); err == nil || errorCode(err) != codeOutputExists {
+		t.Fatalf("expected output_exists for an existing preview, got %v", err)
+	}
+
+	cfg.CirclePreview = outPath
+	cfg.Force = true
+	if _, err := validateConfig(cfg); err == nil {
+		t.Error("expected error for a preview written over the output")
+	}
+
+	cfg.CirclePreview, cfg.Force, cfg.Backup = previewPath, false, true
+	if _, err := validateConfig(cfg); err != nil {
+		t.Fatalf("expected -backup to allow overwriting the preview, got %v", err)
+	}
+
+	if err := runCompress(cfg); err != nil {
+		t.Fatalf("runCompress failed: %v", err)
+	}
+
+	backup, err := os.ReadFile(previewPath + ".bak")
+	if err != nil || string(backup) != "previous" {
+		t.Errorf("expected preview backup with previous contents, got %q (%v)", backup, err)
+	}
+
+	if data, err := os.ReadFile(previewPath); err != nil || !bytes.HasPrefix(data, []byte("\x89PNG")) {
+		t.Errorf("expected a new PNG preview, got %v", err)
+	}
+}
+
+// TestValidateConfig_SniffedFormat() - tests that the default output format comes from the input content
+func TestValidateConfig_SniffedFormat(t *testing.T) {
+	// a JPEG saved with a misleading extension
+	inPath := filepath.Join(t.TempDir(), "photo.img")
+	if err := createTestImage(inPath, 20, 20, "jpg"); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+
+	cfg := &Config{InputPath: inPath, OutputPath: filepath.Join(t.TempDir(), "out"), MaxSize: 1024, Quality: 80}
+	if _, err := validateConfig(cfg); err != nil {
+		t.Fatalf("validateConfig failed: %v", err)
+	}
+
+	if cfg.OutputFormat != "jpeg" {
+		t.Errorf("expected sniffed format jpeg, got %s", cfg.OutputFormat)
+	}
+}
+
+// TestRunCompress_Variants() - tests that -variants writes one file per size into the output directory
+func TestRunCompress_Variants(t *testing.T) {
+	td := t.TempDir()
+	inPath := filepath.Join(td, "me.jpg")
+	outDir := filepath.Join(td, "avatars")
+
+	if err := createTestImage(inPath, 200, 200, "jpg"); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+
+	cfg := &Config{
+		InputPath:  inPath,
+		OutputPath: outDir,
+		MaxSize:    1024 * 1024,
+		Quality:    80,
+		Variants:   "32,64:png",
+	}
+
+	if _, err := validateConfig(cfg); err != nil {
+		t.Fatalf("validateConfig failed: %v", err)
+	}
+
+	if err := runCompress(cfg); err != nil {
+		t.Fatalf("runCompress failed: %v", err)
+	}
+
+	for _, name := range []string{"me-32.jpg", "me-64.png"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Errorf("expected %s to be written: %v", name, err)
+		}
+	}
+
+	// a second run must not overwrite without -force
+	if err := runCompress(cfg); err == nil {
+		t.Error("expected error when variants already exist")
+	}
+}
+
+// TestRunCompress_Srcset() - test that a srcset run writes the ladder into the output directory
+func TestRunCompress_Srcset(t *testing.T) {
+	td := t.TempDir()
+	inPath := filepath.Join(td, "hero.jpg")
+	outDir := filepath.Join(td, "img")
+
+	if err := createTestImage(inPath, 400, 200, "jpg"); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+
+	cfg := &Config{
+		InputPath:     inPath,
+		OutputPath:    outDir,
+		MaxSize:       1024 * 1024,
+		Quality:       80,
+		Srcset:        "100,200,800",
+		SrcsetFormats: "png,jpeg",
+		Snippet:       "markdown",
+	}
+
+	if _, err := validateConfig(cfg); err != nil {
+		t.Fatalf("validateConfig failed: %v", err)
+	}
+
+	if err := runCompress(cfg); err != nil {
+		t.Fatalf("runCompress failed: %v", err)
+	}
+
+	for _, name := range []string{"hero-100.png", "hero-200.png", "hero-100.jpg", "hero-200.jpg"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Errorf("expected %s to be written: %v", name, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(outDir, "hero-800.jpg")); err == nil {
+		t.Error("expected no upscaled 800w image")
+	}
+}
+
+// TestRunPlaceholder() - test the placeholder subcommand in text and JSON mode
+func TestRunPlaceholder(t *testing.T) {
+	inPath := filepath.Join(t.TempDir(), "me.jpg")
+	if err := createTestImage(inPath, 120, 80, "jpg"); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := runPlaceholder([]string{"-json", inPath}, &out); err != nil {
+		t.Fatalf("runPlaceholder failed: %v", err)
+	}
+
+	var line placeholderJSON
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", out.String(), err)
+	}
+
+	if line.Width != 120 || line.Height != 80 || line.BlurHash == "" || line.ThumbHash == "" {
+		t.Errorf("unexpected placeholder %+v", line)
+	}
+
+	out.Reset()
+	if err := runPlaceholder([]string{inPath}, &out); err != nil || !bytes.Contains(out.Bytes(), []byte("BlurHash:  "+line.BlurHash)) {
+		t.Errorf("unexpected text output %q (%v)", out.String(), err)
+	}
+
+	if err := runPlaceholder(nil, &out); err == nil {
+		t.Error("expected error without images")
+	}
+}
+
+// TestRun_Dispatch() - test subcommand dispatch and the flat compatibility invocation
+func TestRun_Dispatch(t *testing.T) {
+	td := t.TempDir()
+	inPath := filepath.Join(td, "in.jpg")
+	if err := createTestImage(inPath, 200, 100, "jpg"); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	if err := run([]string{"-input", inPath, "-output", filepath.Join(td, "flat.jpg")}); err != nil {
+		t.Errorf("flat invocation failed: %v", err)
+	}
+
+	if err := run([]string{"compress", "-input", inPath, "-output", filepath.Join(td, "sub.jpg")}); err != nil {
+		t.Errorf("compress subcommand failed: %v", err)
+	}
+
+	for _, name := range []string{"flat.jpg", "sub.jpg"} {
+		if _, err := os.Stat(filepath.Join(td, name)); err != nil {
+			t.Errorf("expected %s to be written: %v", name, err)
+		}
+	}
+
+	if err := run([]string{"inspect", inPath}); err != nil || !bytes.Contains(out.Bytes(), []byte("Dimensions: 200x100")) {
+		t.Errorf("unexpected inspect output %q (%v)", out.String(), err)
+	}
+
+	out.Reset()
+	if err := run([]string{"presets"}); err != nil || !bytes.Contains(out.Bytes(), []byte("gravatar")) {
+		t.Errorf("unexpected presets output %q (%v)", out.String(), err)
+	}
+
+	// upload options are checked before signing in
+	if err := run([]string{"upload", "gravatar", "-pad", "white", "-crop", "center", inPath}); err == nil || !strings.Contains(err.Error(), "-pad cannot be combined") {
+		t.Errorf("expected error for -pad with -crop, got %v", err)
+	}
+
+	if err := run([]string{"upload", "gravatar", "-pad", "mauve", inPath}); err == nil || !strings.Contains(err.Error(), "-pad is invalid") {
+		t.Errorf("expected error for an invalid -pad, got %v", err)
+	}
+
+	if err := run([]string{"bogus"}); err == nil {
+		t.Error("expected error for an unknown command")
+	}
+
+	if err := run(nil); err != errUsage {
+		t.Errorf("expected usage without arguments, got %v", err)
+	}
+}
+
+// TestParseFlags_Preset() - test that a preset fills in flags without overriding explicit ones
+func TestParseFlags_Preset(t *testing.T) {
+	cfg := mustParseFlags(t, []string{"-preset", "email", "-quality", "95"})
+	if cfg.MaxSize != 51200 || cfg.OutputFormat != "jpeg" || cfg.Crop != "center" {
+		t.Errorf("expected email preset values, got %+v", cfg)
+	}
+
+	if cfg.Quality != 95 {
+		t.Errorf("expected explicit -quality to win, got %d", cfg.Quality)
+	}
+
+	cfg = &Config{InputPath: "in.jpg", OutputPath: "out.jpg", Preset: "nope"}
+	if _, err := validateConfig(cfg); err == nil {
+		t.Error("expected error for an unknown preset")
+	}
+}
+
+// TestRunAuth() - test auth status and logout against a temporary config directory
+func TestRunAuth(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	if err := run([]string{"auth", "status"}); err != nil || !bytes.Contains(out.Bytes(), []byte("Not logged in")) {
+		t.Errorf("unexpected status %q (%v)", out.String(), err)
+	}
+
+	if err := gravatar.SaveToken("abc"); err != nil {
+		t.Fatalf("SaveToken failed: %v", err)
+	}
+
+	out.Reset()
+	if err := run([]string{"auth", "status"}); err != nil || !bytes.Contains(out.Bytes(), []byte("Logged in")) {
+		t.Errorf("unexpected status %q (%v)", out.String(), err)
+	}
+
+	out.Reset()
+	if err := run([]string{"auth", "logout"}); err != nil || !bytes.Contains(out.Bytes(), []byte("Logged out")) {
+		t.Errorf("unexpected logout %q (%v)", out.String(), err)
+	}
+
+	if _, err := gravatar.LoadToken(); err == nil {
+		t.Error("expected token to be gone after logout")
+	}
+
+	if err := run([]string{"auth", "bogus"}); err != errUsage {
+		t.Errorf("expected usage for an unknown auth action, got %v", err)
+	}
+}
+
+// TestRunCompress_Batch() - test directory input with a name template, skipped files and a failing collision
+func TestRunCompress_Batch(t *testing.T) {
+	td := t.TempDir()
+	inDir := filepath.Join(td, "photos")
+	outDir := filepath.Join(td, "out")
+	os.Mkdir(inDir, 0755)
+
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		if err := createTestImage(filepath.Join(inDir, name), 300, 200, "jpg"); err != nil {
+			t.Fatalf("failed to create test image: %v", err)
+		}
+	}
+	os.WriteFile(filepath.Join(inDir, "notes.txt"), []byte("not an image"), 0644)
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	cfg := &Config{
+		InputPath:    inDir,
+		OutputPath:   outDir,
+		MaxSize:      1024 * 1024,
+		Quality:      80,
+		Jobs:         2,
+		NameTemplate: "{name}_{width}.{ext}",
+	}
+
+	if _, err := validateConfig(cfg); err != nil {
+		t.Fatalf("validateConfig failed: %v", err)
+	}
+
+	if err := runCompress(cfg); err != nil {
+		t.Fatalf("runCompress failed: %v\n%s", err, out.String())
+	}
+
+	for _, name := range []string{"a_300.jpg", "b_300.jpg"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Errorf("expected %s to be written: %v", name, err)
+		}
+	}
+
+	if !bytes.Contains(out.Bytes(), []byte("3 files: 2 compressed, 1 skipped, 0 failed")) {
+		t.Errorf("unexpected summary:\n%s", out.String())
+	}
+
+	// rerunning without -force fails every file and the run as a whole
+	out.Reset()
+	if err := runCompress(cfg); err == nil || !bytes.Contains(out.Bytes(), []byte("2 failed")) {
+		t.Errorf("expected failures for existing outputs, got %v:\n%s", err, out.String())
+	}
+
+	// a glob with -skip-under-cap leaves small inputs alone
+	out.Reset()
+	cfg = &Config{InputPath: filepath.Join(inDir, "*.jpg"), OutputPath: filepath.Join(td, "skip"), MaxSize: 1024 * 1024, Quality: 80, Jobs: 1, SkipUnderCap: true}
+	if _, err := validateConfig(cfg); err != nil {
+		t.Fatalf("validateConfig failed: %v", err)
+	}
+
+	if err := runCompress(cfg); err != nil || !bytes.Contains(out.Bytes(), []byte("0 compressed, 2 skipped")) {
+		t.Errorf("expected both inputs to be skipped, got %v:\n%s", err, out.String())
+	}
+
+	if _, err := validateConfig(&Config{InputPath: inDir, OutputPath: outDir, MaxSize: 1, Quality: 80, Jobs: 1, NameTemplate: "{nope}"}); err == nil {
+		t.Error("expected error for an unknown template field")
+	}
+}
+
+// TestRunCompressCommand_BatchPercent() - test that a percentage -maxsize is resolved against each batch input
+func TestRunCompressCommand_BatchPercent(t *testing.T) {
+	td := t.TempDir()
+	inDir, outDir := filepath.Join(td, "photos"), filepath.Join(td, "out")
+	os.Mkdir(inDir, 0755)
+
+	for name, side := range map[string]int{"a.jpg": 300, "b.jpg": 600} {
+		if err := createTestImage(filepath.Join(inDir, name), side, side, "jpg"); err != nil {
+			t.Fatalf("failed to create test image: %v", err)
+		}
+	}
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	if err := runCompressCommand([]string{"-input", inDir, "-output", outDir, "-maxsize", "50%"}); err != nil {
+		t.Fatalf("runCompressCommand failed: %v\n%s", err, out.String())
+	}
+
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		if in, out := fileSize(filepath.Join(inDir, name)), fileSize(filepath.Join(outDir, name)); out == 0 || out > in/2 {
+			t.Errorf("expected %s within half of its %d bytes, got %d", name, in, out)
+		}
+	}
+}
+
+// TestRunCompress_Resume() - test that a manifest records every input and -resume only redoes changed ones
+func TestRunCompress_Resume(t *testing.T) {
+	for _, ext := range []string{".json", ".csv"} {
+		t.Run(ext, func(t *testing.T) {
+			td := t.TempDir()
+			inDir := filepath.Join(td, "photos")
+			os.Mkdir(inDir, 0755)
+
+			for _, name := range []string{"a.jpg", "b.jpg"} {
+				if err := createTestImage(filepath.Join(inDir, name), 300, 200, "jpg"); err != nil {
+					t.Fatalf("failed to create test image: %v", err)
+				}
+			}
+
+			var out bytes.Buffer
+			stdout = &out
+			defer func() { stdout = os.Stdout }()
+
+			manifestPath := filepath.Join(td, "manifest"+ext)
+			cfg := &Config{InputPath: inDir, OutputPath: filepath.Join(td, "out"), MaxSize: 1024 * 1024, Quality: 80, Jobs: 2, Force: true, Manifest: manifestPath}
+			if _, err := validateConfig(cfg); err != nil {
+				t.Fatalf("validateConfig failed: %v", err)
+			}
+
+			if err := runCompress(cfg); err != nil {
+				t.Fatalf("runCompress failed: %v", err)
+			}
+
+			entries, err := loadManifest(manifestPath)
+			if err != nil || len(entries) != 2 {
+				t.Fatalf("expected 2 manifest entries, got %v (%v)", entries, err)
+			}
+
+			if e := entries[filepath.Join(inDir, "a.jpg")]; e.SHA256 == "" || e.Width != 300 || e.Size == 0 || e.SSIM == 0 {
+				t.Errorf("incomplete manifest entry %+v", e)
+			}
+
+			if _, err := os.Stat(journalPath(manifestPath)); !os.IsNotExist(err) {
+				t.Errorf("expected the journal to be removed after the run, got %v", err)
+			}
+
+			// change one input, only that one is compressed again
+			if err := createTestImage(filepath.Join(inDir, "b.jpg"), 320, 200, "jpg"); err != nil {
+				t.Fatalf("failed to rewrite test image: %v", err)
+			}
+
+			out.Reset()
+			cfg.Manifest, cfg.Resume = "", manifestPath
+			if err := runCompress(cfg); err != nil {
+				t.Fatalf("resumed run failed: %v", err)
+			}
+
+			if !bytes.Contains(out.Bytes(), []byte("1 compressed, 1 skipped")) {
+				t.Errorf("expected one resumed and one redone input:\n%s", out.String())
+			}
+
+			if entries, _ := loadManifest(manifestPath); entries[filepath.Join(inDir, "b.jpg")].Width != 320 {
+				t.Errorf("expected the manifest to be updated, got %+v", entries[filepath.Join(inDir, "b.jpg")])
+			}
+		})
+	}
+
+	single := filepath.Join(t.TempDir(), "in.jpg")
+	createTestImage(single, 10, 10, "jpg")
+	if _, err := validateConfig(&Config{InputPath: single, OutputPath: single + ".out.jpg", MaxSize: 1000, Quality: 80, Manifest: "m.json"}); err == nil {
+		t.Error("expected error for -manifest with a single input")
+	}
+}
+
+// TestManifest_Journal() - test that entries are appended to a journal and survive a run that never flushes
+func TestManifest_Journal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.json")
+	earlier := manifestEntry{Input: "old.jpg", SHA256: "0", Params: "p"}
+	mf := &manifest{path: path, entries: map[string]manifestEntry{earlier.Input: earlier}}
+
+	mf.record(manifestEntry{Input: "a.jpg", SHA256: "1", Params: "p", Width: 10})
+	mf.record(manifestEntry{Input: "b.jpg", SHA256: "2", Params: "p", Error: "broken"})
+
+	// the file holds the carried-over entries, new ones only reach the journal until flush
+	data, _ := os.ReadFile(journalPath(path))
+	if n := bytes.Count(data, []byte("\n")); n != 2 {
+		t.Errorf("expected 2 journal lines, got %d:\n%s", n, data)
+	}
+
+	// a crash mid-write leaves a partial last line behind
+	f, _ := os.OpenFile(journalPath(path), os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"input":"c.jpg","sha`)
+	f.Close()
+	mf.journal.Close()
+
+	entries, err := loadManifest(path)
+	if err != nil || len(entries) != 3 || entries["a.jpg"].Width != 10 || entries["b.jpg"].Error != "broken" || entries["old.jpg"].SHA256 != "0" {
+		t.Fatalf("expected the earlier and journaled entries back, got %+v (%v)", entries, err)
+	}
+
+	// a resumed run folds the journal into the file before starting its own
+	mf = &manifest{path: path, entries: entries}
+	mf.record(manifestEntry{Input: "c.jpg", SHA256: "3", Params: "p"})
+	if err := mf.flush(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+
+	if _, err := os.Stat(journalPath(path)); !os.IsNotExist(err) {
+		t.Errorf("expected the journal to be removed, got %v", err)
+	}
+	if entries, err := loadManifest(path); err != nil || len(entries) != 4 {
+		t.Errorf("expected 4 entries after flush, got %+v (%v)", entries, err)
+	}
+}
+
+// TestRunCompressCommand_Pipe() - test reading the image from stdin and writing it to stdout
+func TestRunCompressCommand_Pipe(t *testing.T) {
+	inPath := filepath.Join(t.TempDir(), "in.jpg")
+	if err := createTestImage(inPath, 200, 100, "jpg"); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+
+	data, _ := os.ReadFile(inPath)
+
+	var img, msgs bytes.Buffer
+	imageIn, imageOut = bytes.NewReader(data), &img
+	stdout, compressor.LogOutput = &msgs, &msgs
+	defer func() {
+		imageIn, imageOut = os.Stdin, os.Stdout
+		stdout, compressor.LogOutput = os.Stdout, os.Stdout
+	}()
+
+	if err := runCompressCommand([]string{"-input", "-", "-output", "-", "-format", "png", "-v"}); err != nil {
+		t.Fatalf("runCompressCommand failed: %v", err)
+	}
+
+	if !bytes.HasPrefix(img.Bytes(), []byte("\x89PNG")) {
+		t.Fatalf("expected only a PNG on stdout, got %q", img.Bytes()[:min(16, img.Len())])
+	}
+
+	// -v messages went to stderr during the run, and both writers are back afterwards
+	if msgs.Len() != 0 {
+		t.Errorf("expected messages to be sent to stderr, got %q", msgs.String())
+	}
+	if stdout != io.Writer(&msgs) || compressor.LogOutput != io.Writer(&msgs) {
+		t.Error("expected stdout and the compressor log to be restored")
+	}
+
+	// the format is sniffed from stdin when -format is left out
+	img.Reset()
+	imageIn = bytes.NewReader(data)
+	if err := runCompressCommand([]string{"-input", "-", "-output", "-"}); err != nil || !bytes.HasPrefix(img.Bytes(), []byte("\xff\xd8")) {
+		t.Errorf("expected a JPEG from JPEG stdin (%v)", err)
+	}
+
+	imageIn = bytes.NewReader(nil)
+	if err := runCompressCommand([]string{"-input", "-", "-output", "-"}); err == nil {
+		t.Error("expected error for empty stdin")
+	}
+
+	if _, err := validateConfig(&Config{InputPath: inPath, OutputPath: "-", MaxSize: 1000, Quality: 80, Variants: "32"}); err == nil {
+		t.Error("expected error for -variants with -output -")
+	}
+}
+
+// TestParseFlags_MaxSize() - test human-readable and relative -maxsize values
+func TestParseFlags_MaxSize(t *testing.T) {
+	if cfg := mustParseFlags(t, []string{"-maxsize", "500KB"}); cfg.MaxSize != 500000 || cfg.MaxSizePercent != 0 {
+		t.Errorf("expected 500000 bytes, got %d (%g%%)", cfg.MaxSize, cfg.MaxSizePercent)
+	}
+
+	if cfg := mustParseFlags(t, []string{"-maxsize", "1MiB"}); cfg.MaxSize != 1048576 {
+		t.Errorf("expected 1048576 bytes, got %d", cfg.MaxSize)
+	}
+
+	inPath := filepath.Join(t.TempDir(), "in.jpg")
+	if err := createTestImage(inPath, 200, 200, "jpg"); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+	info, _ := os.Stat(inPath)
+
+	cfg := mustParseFlags(t, []string{"-input", inPath, "-output", inPath + ".out.jpg", "-maxsize", "50%"})
+	if _, err := validateConfig(cfg); err != nil {
+		t.Fatalf("validateConfig failed: %v", err)
+	}
+
+	if want := int(info.Size() / 2); cfg.MaxSize != want {
+		t.Errorf("expected half the input (%d bytes), got %d", want, cfg.MaxSize)
+	}
+
+	var f sizeFlag
+	var bytes int
+	var percent float64
+	f.bytes, f.percent = &bytes, &percent
+	if err := f.Set("lots"); err == nil {
+		t.Error("expected error for a malformed size")
+	}
+}
+
+// TestParseFlags_ConfigCommandLineOnly() - test that config files and the environment cannot pick the files a run reads or writes
+func TestParseFlags_ConfigCommandLineOnly(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	for _, content := range []string{"output: stolen.jpg\n", "force: true\n", "profiles:\n  web:\n    input: secret.png\n"} {
+		if err := os.WriteFile(filepath.Join(dir, ".gitfit.yaml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := parseFlags([]string{"-profile", "web"}); err == nil || !strings.Contains(err.Error(), "command line") {
+			t.Errorf("%q: expected a command-line-only error, got %v", content, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ".gitfit.yaml"), []byte("quality: 70\nprofiles:\n  web:\n    format: png\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(envVar("input"), "secret.png")
+	t.Setenv(envVar("output"), "stolen.jpg")
+	cfg := mustParseFlags(t, []string{"-profile", "web", "-input", "in.jpg"})
+	if cfg.InputPath != "in.jpg" || cfg.OutputPath != "" || cfg.Quality != 70 || cfg.OutputFormat != "png" {
+		t.Errorf("expected tuning settings only from config and environment, got %+v", cfg)
+	}
+}
+
+// TestParseFlags_Config() - test precedence of flags, environment, project config, user config and profiles
+func TestParseFlags_Config(t *testing.T) {
+	dir := t.TempDir()
+	defer func(orig func() (string, error)) { userConfigDir = orig }(userConfigDir)
+	userConfigDir = func() (string, error) { return filepath.Join(dir, "home"), nil }
+
+	if err := os.MkdirAll(filepath.Join(dir, "home", "gitfit"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	user := "maxsize: 500KB\nformat: png\nquality: 70\nprofiles:\n  slack:\n    maxsize: 200KB\n    crop: center\n"
+	if err := os.WriteFile(filepath.Join(dir, "home", "gitfit", "config.yaml"), []byte(user), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	project := filepath.Join(dir, "project", "sub")
+	if err := os.MkdirAll(project, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "project", ".gitfit.toml"), []byte("quality = 75\n[profiles.slack]\nformat = \"jpeg\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(project)
+
+	cfg := mustParseFlags(t, nil)
+	if cfg.MaxSize != 500000 || cfg.OutputFormat != "png" || cfg.Quality != 75 {
+		t.Errorf("expected user maxsize and format with project quality, got %+v", cfg)
+	}
+
+	t.Setenv("GITFIT_QUALITY", "60")
+	cfg = mustParseFlags(t, []string{"-profile", "slack"})
+	if cfg.MaxSize != 200000 || cfg.Crop != "center" || cfg.OutputFormat != "jpeg" || cfg.Quality != 60 {
+		t.Errorf("expected slack profile with env quality, got %+v", cfg)
+	}
+
+	cfg = mustParseFlags(t, []string{"-profile", "slack", "-quality", "90", "-format", "gif"})
+	if cfg.Quality != 90 || cfg.OutputFormat != "gif" {
+		t.Errorf("expected flags to win, got %+v", cfg)
+	}
+
+	// a preset given as a flag outranks the environment and config files, but not other flags
+	cfg = mustParseFlags(t, []string{"-preset", "email", "-maxsize", "10KB"})
+	if cfg.MaxSize != 10000 || cfg.OutputFormat != "jpeg" || cfg.Quality != 80 {
+		t.Errorf("expected email preset under explicit flags, got %+v", cfg)
+	}
+
+	if _, err := parseFlags([]string{"-profile", "nope"}); err == nil {
+		t.Error("expected error for an unknown profile")
+	}
+
+	t.Setenv("GITFIT_QUALITY", "high")
+	if _, err := parseFlags(nil); err == nil || !strings.Contains(err.Error(), "GITFIT_QUALITY") {
+		t.Errorf("expected error naming GITFIT_QUALITY, got %v", err)
+	}
+	os.Unsetenv("GITFIT_QUALITY")
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	if err := run([]string{"config", "show", "-profile", "slack"}); err != nil {
+		t.Fatalf("config show failed: %v", err)
+	}
+	for _, want := range []string{".gitfit.toml", "profile slack in", "200KB", "(default)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in config show output:\n%s", want, out.String())
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "project", ".gitfit.toml"), []byte("qualty = 75\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseFlags(nil); err == nil || !strings.Contains(err.Error(), "qualty") {
+		t.Errorf("expected error for an unknown key, got %v", err)
+	}
+}
+
+// TestRunCompressCommand_JSON() - test -json reports for single, failed and batch runs
+func TestRunCompressCommand_JSON(t *testing.T) {
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "in", "a.jpg")
+	if err := os.MkdirAll(filepath.Dir(inPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestImage(inPath, 200, 100, "jpg"); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	outPath := filepath.Join(dir, "out.png")
+	if err := runCompressCommand([]string{"-input", inPath, "-output", outPath, "-format", "png", "-placeholder", "-json"}); err != nil {
+		t.Fatalf("runCompressCommand failed: %v", err)
+	}
+
+	var report compressReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("expected a JSON report, got %q: %v", out.String(), err)
+	}
+	if report.Status != "ok" || report.Output != outPath || report.Format != "png" || report.Width != 200 || report.InputSize == 0 || report.OutputSize == 0 || report.BlurHash == "" {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if jsonOut != nil || stdout != &out {
+		t.Error("expected -json to restore the outputs")
+	}
+
+	out.Reset()
+	if err := runCompressCommand([]string{"-input", filepath.Join(dir, "missing.jpg"), "-output", outPath, "-json"}); err != errReported {
+		t.Errorf("expected errReported, got %v", err)
+	}
+	report = compressReport{}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil || report.Status != "error" || report.Error == nil || report.Error.Code != codeInputNotFound {
+		t.Errorf("expected an input_not_found report, got %q (%v)", out.String(), err)
+	}
+
+	out.Reset()
+	if err := runCompressCommand([]string{"-input", inPath, "-output", outPath, "-json"}); err != errReported || !bytes.Contains(out.Bytes(), []byte(codeOutputExists)) {
+		t.Errorf("expected an output_exists report, got %q (%v)", out.String(), err)
+	}
+
+	// flag errors are reported too, even when parsing stops before -json
+	for _, args := range [][]string{{"-bogus", "-input", inPath, "-json"}, {"-json", "-quality", "high"}, {"-jobs", "x", "--json=true"}} {
+		out.Reset()
+		if err := runCompressCommand(args); err != errReported {
+			t.Errorf("%v: expected errReported, got %v", args, err)
+		}
+		report = compressReport{}
+		if err := json.Unmarshal(out.Bytes(), &report); err != nil || report.Error == nil || report.Error.Code != codeInvalidArguments {
+			t.Errorf("%v: expected an invalid_arguments report, got %q (%v)", args, out.String(), err)
+		}
+	}
+
+	// without -json the usage is printed as before
+	out.Reset()
+	if err := runCompressCommand([]string{"-bogus", "-json=false"}); err != errUsage || !strings.Contains(out.String(), "Usage:") {
+		t.Errorf("expected usage for an unknown flag, got %q (%v)", out.String(), err)
+	}
+
+	// batch runs print one object per input
+	if err := createTestImage(filepath.Join(dir, "in", "b.jpg"), 120, 120, "jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "in", "notes.txt"), []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	if err := runCompressCommand([]string{"-input", filepath.Join(dir, "in"), "-output", filepath.Join(dir, "batch"), "-json", "-jobs", "2"}); err != nil {
+		t.Fatalf("batch failed: %v", err)
+	}
+
+	statuses := map[string]string{}
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	for _, line := range lines {
+		var r compressReport
+		if err := json.Unmarshal(line, &r); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+		statuses[filepath.Base(r.Input)] = r.Status
+	}
+	if len(lines) != 3 || statuses["a.jpg"] != "ok" || statuses["b.jpg"] != "ok" || statuses["notes.txt"] != "skipped" {
+		t.Errorf("unexpected batch reports %q", out.String())
+	}
+
+	if code := errorCode(fmt.Errorf("compressing image failed: %w", &compressor.UnreachableError{Reason: "too big"})); code != codeTargetUnreachable {
+		t.Errorf("expected %s, got %s", codeTargetUnreachable, code)
+	}
+}
+
+// TestRunInspect_JSON() - test inspect's JSON output and preset estimates
+func TestRunInspect_JSON(t *testing.T) {
+	inPath := filepath.Join(t.TempDir(), "in.jpg")
+	if err := createTestImage(inPath, 200, 100, "jpg"); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	if err := run([]string{"inspect", "-json", inPath}); err != nil {
+		t.Fatalf("inspect failed: %v", err)
+	}
+
+	var info inspectJSON
+	if err := json.Unmarshal(out.Bytes(), &info); err != nil {
+		t.Fatalf("expected JSON, got %q: %v", out.String(), err)
+	}
+	if info.Format != "jpeg" || info.Width != 200 || info.Height != 100 || info.Frames != 1 || info.ICC != nil || len(info.Presets) != len(presets) {
+		t.Errorf("unexpected inspect output %+v", info)
+	}
+
+	for _, e := range info.Presets {
+		if e.Error != "" || !e.Reachable || e.Size > e.MaxSize {
+			t.Errorf("expected %s to fit a small image, got %+v", e.Preset, e)
+		}
+	}
+
+	out.Reset()
+	if err := run([]string{"inspect", "-estimate=false", inPath}); err != nil || !bytes.Contains(out.Bytes(), []byte("EXIF:       none")) || bytes.Contains(out.Bytes(), []byte("Presets")) {
+		t.Errorf("unexpected inspect output %q (%v)", out.String(), err)
+	}
+}
+
+// TestWatchDir() - test that watch compresses new files once they settle and leaves existing ones alone
+func TestWatchDir(t *testing.T) {
+	dir := t.TempDir()
+	in, outDir := filepath.Join(dir, "in"), filepath.Join(dir, "out")
+	if err := os.MkdirAll(in, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestImage(filepath.Join(in, "old.jpg"), 80, 80, "jpg"); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	cfg := &Config{OutputPath: outDir, MaxSize: 1 << 20, Quality: 85, NameTemplate: defaultNameTemplate, OutputFormat: "png"}
+	w := watchOptions{Dir: in, Interval: 10 * time.Millisecond, Settle: 50 * time.Millisecond}
+	if err := validateWatch(cfg, w); err != nil {
+		t.Fatalf("validateWatch failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- watchDir(ctx, cfg, w) }()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := createTestImage(filepath.Join(in, "new.jpg"), 120, 60, "jpg"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(filepath.Join(outDir, "new.png")); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatalf("watchDir failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outDir, "new.png")); err != nil {
+		t.Errorf("expected new.jpg to be compressed, log: %q", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "old.png")); err == nil {
+		t.Error("expected the image present at start to be left alone")
+	}
+	if !strings.Contains(out.String(), "ok    "+filepath.Join(in, "new.jpg")) {
+		t.Errorf("expected an ok line, got %q", out.String())
+	}
+
+	if err := validateWatch(&Config{OutputPath: in, MaxSize: 1, Quality: 85}, w); err == nil {
+		t.Error("expected error for an output inside the watched folder")
+	}
+}
+
+// TestWatchDir_MaxSizePercent() - test that watch accepts a percentage -maxsize and resolves it per file
+func TestWatchDir_MaxSizePercent(t *testing.T) {
+	dir := t.TempDir()
+	in, outDir := filepath.Join(dir, "in"), filepath.Join(dir, "out")
+	if err := os.MkdirAll(in, 0755); err != nil {
+		t.Fatal(err)
+	}
+	inPath := filepath.Join(in, "photo.jpg")
+	if err := createTestImage(inPath, 400, 400, "jpg"); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	cfg := &Config{OutputPath: outDir, MaxSizePercent: 50, Quality: 85, NameTemplate: defaultNameTemplate}
+	w := watchOptions{Dir: in, Interval: 10 * time.Millisecond, Existing: true}
+	if err := validateWatch(cfg, w); err != nil {
+		t.Fatalf("validateWatch failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- watchDir(ctx, cfg, w) }()
+
+	outPath := filepath.Join(outDir, "photo.jpg")
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(outPath); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatalf("watchDir failed: %v", err)
+	}
+
+	if size := fileSize(outPath); size == 0 || size > fileSize(inPath)/2 {
+		t.Errorf("expected output within half of the input, got %d bytes, log: %q", size, out.String())
+	}
+}
+
+// TestRunCompressCommand_URL() - test URL input against a local server, including its content-type, size and time limits
+func TestRunCompressCommand_URL(t *testing.T) {
+	dir := t.TempDir()
+	imgPath := filepath.Join(dir, "avatar.jpg")
+	if err := createTestImage(imgPath, 160, 160, "jpg"); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+	data, _ := os.ReadFile(imgPath)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/avatar", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(data)
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html></html>"))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		w.Write(data)
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	// the query string must not make the URL look like a glob
+	outPath := filepath.Join(dir, "out.png")
+	if err := runCompressCommand([]string{"-input", srv.URL + "/avatar?s=2048", "-output", outPath, "-format", "png", "-json"}); err != nil {
+		t.Fatalf("runCompressCommand failed: %v (%s)", err, out.String())
+	}
+
+	var report compressReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil || report.Status != "ok" || report.Input != srv.URL+"/avatar?s=2048" || report.InputSize != int64(len(data)) {
+		t.Errorf("unexpected report %q (%v)", out.String(), err)
+	}
+	if _, err := os.Stat(outPath); err != nil {
+		t.Errorf("expected output file: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"not an image", []string{"-input", srv.URL + "/page"}, "not an image"},
+		{"not found", []string{"-input", srv.URL + "/missing"}, "404"},
+		{"too large", []string{"-input", srv.URL + "/avatar", "-max-download", "100"}, "larger than -max-download"},
+		{"timeout", []string{"-input", srv.URL + "/slow", "-download-timeout", "50ms"}, "failed to download"},
+	} {
+		out.Reset()
+		args := append(tt.args, "-output", filepath.Join(dir, "fail.png"), "-json")
+		if err := runCompressCommand(args); err != errReported {
+			t.Errorf("%s: expected errReported, got %v", tt.name, err)
+		}
+
+		report = compressReport{}
+		json.Unmarshal(out.Bytes(), &report)
+		if report.Error == nil || report.Error.Code != codeDownloadFailed || !strings.Contains(report.Error.Message, tt.want) {
+			t.Errorf("%s: expected a download_failed report mentioning %q, got %q", tt.name, tt.want, out.String())
+		}
+	}
+
+	// a missing limit is a bad argument, not a failed download
+	if _, err := downloadInput(&Config{InputPath: srv.URL + "/avatar"}); errorCode(err) != codeInvalidArguments {
+		t.Errorf("expected invalid_arguments for no -max-download, got %s (%v)", errorCode(err), err)
+	}
+
+	out.Reset()
+	t.Setenv(envVar("max-download"), "0")
+	if err := runCompressCommand([]string{"-input", srv.URL + "/avatar", "-output", filepath.Join(dir, "fail.png"), "-json"}); err != errReported {
+		t.Errorf("expected errReported for GITFIT_MAX_DOWNLOAD=0, got %v", err)
+	}
+
+	report = compressReport{}
+	json.Unmarshal(out.Bytes(), &report)
+	if report.Error == nil || report.Error.Code != codeInvalidArguments {
+		t.Errorf("expected an invalid_arguments report for GITFIT_MAX_DOWNLOAD=0, got %q", out.String())
+	}
+}
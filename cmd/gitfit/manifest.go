@@ -0,0 +1,347 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nabiladem/git-fit/internal/compressor"
+)
+
+// manifestColumns are the CSV manifest columns, in order
+var manifestColumns = []string{"input", "sha256", "params", "output", "format", "width", "height", "quality", "size", "ssim", "skipped", "error"}
+
+// manifestEntry records what a batch run did with one input
+/* Input (string) - input path; SHA256 (string) - hash of the input contents
+   Params (string) - fingerprint of the settings it was compressed with; Output (string) - written file
+   Format, Width, Height, Quality, Size, SSIM - describe the output
+   Skipped (string) - why the input was left alone; Error (string) - why it failed */
+type manifestEntry struct {
+	Input   string  `json:"input"`
+	SHA256  string  `json:"sha256"`
+	Params  string  `json:"params"`
+	Output  string  `json:"output,omitempty"`
+	Format  string  `json:"format,omitempty"`
+	Width   int     `json:"width,omitempty"`
+	Height  int     `json:"height,omitempty"`
+	Quality int     `json:"quality,omitempty"`
+	Size    int     `json:"size,omitempty"`
+	SSIM    float64 `json:"ssim,omitempty"`
+	Skipped string  `json:"skipped,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// manifest appends each finished input to a journal next to the file and rewrites the file once at the end,
+// so an interrupted run leaves a usable record without rewriting everything per input
+/* path (string) - manifest file, CSV when it ends in .csv and JSON otherwise
+   entries (map[string]manifestEntry) - entries by input path; journal (*os.File) - open journal, nil until the first entry
+   err (error) - first write failure */
+type manifest struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]manifestEntry
+	journal *os.File
+	err     error
+}
+
+// manifestJSON is the layout of a JSON manifest
+/* Files ([]manifestEntry) - one entry per input, sorted by input path */
+type manifestJSON struct {
+	Files []manifestEntry `json:"files"`
+}
+
+// validManifestPath() - check that a manifest path has a supported extension
+/* path (string) - value of -manifest or -resume */
+func validManifestPath(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".csv":
+		return nil
+	}
+
+	return fmt.Errorf("manifest %s must end in .json or .csv", path)
+}
+
+// loadManifest() - read the entries of an earlier manifest by input path, none when the file does not exist yet
+/* path (string) - manifest file */
+func loadManifest(path string) (map[string]manifestEntry, error) {
+	entries := map[string]manifestEntry{}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var list []manifestEntry
+	if isCSVManifest(path) {
+		list, err = readCSVManifest(f)
+	} else {
+		var doc manifestJSON
+		err = json.NewDecoder(f).Decode(&doc)
+		list = doc.Files
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %v", path, err)
+	}
+
+	for _, e := range list {
+		entries[e.Input] = e
+	}
+
+	return entries, replayJournal(path, entries)
+}
+
+// journalPath() - path of the journal an unfinished run appends its entries to
+/* path (string) - manifest file */
+func journalPath(path string) string {
+	return path + ".journal"
+}
+
+// replayJournal() - apply the entries of an interrupted run's journal on top of the manifest's, if there is one
+/* path (string) - manifest file; entries (map[string]manifestEntry) - entries read from the manifest, updated in place */
+func replayJournal(path string, entries map[string]manifestEntry) error {
+	f, err := os.Open(journalPath(path))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// a crash can cut the last line short, so it and anything after it is ignored
+	dec := json.NewDecoder(f)
+	for {
+		var e manifestEntry
+		if err := dec.Decode(&e); err != nil {
+			return nil
+		}
+		entries[e.Input] = e
+	}
+}
+
+// record() - add or replace the entry of one input and append it to the journal, keeping the first write error
+/* m (*manifest) - manifest to update
+   e (manifestEntry) - outcome of one input */
+func (m *manifest) record(e manifestEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[e.Input] = e
+	if m.err != nil {
+		return
+	}
+
+	if m.journal == nil {
+		if err := m.openJournal(); err != nil {
+			m.err = fmt.Errorf("failed to write manifest %s: %v", m.path, err)
+			return
+		}
+	}
+
+	line, err := json.Marshal(e)
+	if err == nil {
+		_, err = m.journal.Write(append(line, '\n'))
+	}
+	if err != nil {
+		m.err = fmt.Errorf("failed to write manifest journal %s: %v", m.journal.Name(), err)
+	}
+}
+
+// openJournal() - write the entries carried over so far, then start an empty journal for this run
+/* m (*manifest) - manifest to journal, with mu held */
+func (m *manifest) openJournal() error {
+	// entries replayed from an earlier journal must reach the file before that journal is truncated
+	if err := m.write(); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(journalPath(m.path), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	m.journal = f
+	return nil
+}
+
+// flush() - rewrite the manifest with every entry, drop the journal and report the first write failure of the run
+/* m (*manifest) - manifest to write */
+func (m *manifest) flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.journal != nil {
+		m.journal.Close()
+		m.journal = nil
+	}
+
+	// on failure the journal stays, so -resume still sees what was done
+	if m.err != nil {
+		return m.err
+	}
+
+	if err := m.write(); err != nil {
+		return fmt.Errorf("failed to write manifest %s: %v", m.path, err)
+	}
+
+	if err := os.Remove(journalPath(m.path)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove manifest journal: %v", err)
+	}
+
+	return nil
+}
+
+// write() - write every entry, sorted by input path, replacing the file atomically
+/* m (*manifest) - manifest to write, with mu held */
+func (m *manifest) write() error {
+	list := make([]manifestEntry, 0, len(m.entries))
+	for _, e := range m.entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Input < list[j].Input })
+
+	var data []byte
+	if isCSVManifest(m.path) {
+		var b strings.Builder
+		w := csv.NewWriter(&b)
+		w.Write(manifestColumns)
+		for _, e := range list {
+			w.Write([]string{e.Input, e.SHA256, e.Params, e.Output, e.Format,
+				strconv.Itoa(e.Width), strconv.Itoa(e.Height), strconv.Itoa(e.Quality), strconv.Itoa(e.Size),
+				strconv.FormatFloat(e.SSIM, 'f', 4, 64), e.Skipped, e.Error})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		data = []byte(b.String())
+	} else {
+		var err error
+		if data, err = json.MarshalIndent(manifestJSON{Files: list}, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	}
+
+	return compressor.WriteFileAtomic(m.path, data)
+}
+
+// readCSVManifest() - parse a CSV manifest written by write()
+/* r (io.Reader) - CSV contents */
+func readCSVManifest(r io.Reader) ([]manifestEntry, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	if strings.Join(rows[0], ",") != strings.Join(manifestColumns, ",") {
+		return nil, fmt.Errorf("unexpected header %v", rows[0])
+	}
+
+	list := make([]manifestEntry, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		e := manifestEntry{Input: row[0], SHA256: row[1], Params: row[2], Output: row[3], Format: row[4], Skipped: row[10], Error: row[11]}
+		e.Width, _ = strconv.Atoi(row[5])
+		e.Height, _ = strconv.Atoi(row[6])
+		e.Quality, _ = strconv.Atoi(row[7])
+		e.Size, _ = strconv.Atoi(row[8])
+		e.SSIM, _ = strconv.ParseFloat(row[9], 64)
+		list = append(list, e)
+	}
+
+	return list, nil
+}
+
+// isCSVManifest() - report whether a manifest path is written as CSV
+/* path (string) - manifest file */
+func isCSVManifest(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".csv")
+}
+
+// manifestEntryFor() - describe a batch result as a manifest entry
+/* r (batchResult) - outcome of one input; sum (string) - hash of the input; params (string) - settings fingerprint */
+func manifestEntryFor(r batchResult, sum, params string) manifestEntry {
+	e := manifestEntry{Input: r.Input, SHA256: sum, Params: params, Output: r.Output, Skipped: r.Skipped}
+
+	if r.Err != nil {
+		e.Error = r.Err.Error()
+	}
+
+	if r.Result != nil {
+		e.Format, e.Width, e.Height = r.Result.Format, r.Result.Width, r.Result.Height
+		e.Quality, e.Size, e.SSIM = r.Result.Quality, r.Result.Size, r.Result.SSIM
+	}
+
+	return e
+}
+
+// resumable() - report whether an earlier entry already covers this input with these settings
+/* e (manifestEntry) - earlier entry; sum (string) - current hash of the input; params (string) - current settings fingerprint */
+func resumable(e manifestEntry, sum, params string) bool {
+	if e.Error != "" || e.SHA256 != sum || e.Params != params {
+		return false
+	}
+
+	// a deleted output has to be produced again
+	if e.Output != "" {
+		if _, err := os.Stat(e.Output); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hashFile() - hex SHA-256 of a file's contents
+/* path (string) - file to hash */
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// batchParams() - fingerprint the settings that change what a batch run writes, so -resume redoes files when they change
+/* cfg (*Config) - configuration for compression */
+func batchParams(cfg *Config) string {
+	fields := []string{
+		"maxsize=" + compressor.Size{Bytes: cfg.MaxSize, Percent: cfg.MaxSizePercent}.String(),
+		"format=" + cfg.OutputFormat,
+		"quality=" + strconv.Itoa(cfg.Quality),
+		"min-ssim=" + strconv.FormatFloat(cfg.MinSSIM, 'g', -1, 64),
+		"crop=" + cfg.Crop,
+		"focus=" + cfg.Focus,
+		"pad=" + cfg.Pad,
+		"svg-size=" + strconv.Itoa(cfg.SVGSize),
+		"name=" + cfg.NameTemplate,
+		"skip-under-cap=" + strconv.FormatBool(cfg.SkipUnderCap),
+		"output=" + cfg.OutputPath,
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// stdioPath is the -input or -output value that means stdin or stdout
+const stdioPath = "-"
+
+// imageIn and imageOut carry the image for -input - and -output -, swapped out by tests
+var (
+	imageIn  io.Reader = os.Stdin
+	imageOut io.Writer = os.Stdout
+)
+
+// spoolStdin() - copy the image on stdin to a temp file, so it is sniffed and decoded like any other input
+func spoolStdin() (string, error) {
+	f, err := os.CreateTemp("", "gitfit-stdin-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to buffer stdin: %v", err)
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, imageIn)
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to read stdin: %v", err)
+	}
+
+	if n == 0 {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("no image on stdin")
+	}
+
+	return f.Name(), nil
+}
+
+// writeImageOut() - copy a finished output file to stdout
+/* path (string) - compressed image */
+func writeImageOut(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(imageOut, f); err != nil {
+		return fmt.Errorf("failed to write image to stdout: %v", err)
+	}
+
+	return nil
+}
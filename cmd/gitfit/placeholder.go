@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/nabiladem/git-fit/internal/compressor"
+)
+
+// placeholderJSON is one line of `gitfit placeholder -json` output
+/* File (string) - image path; Width, Height (int) - image dimensions
+   BlurHash (string) - BlurHash string; ThumbHash (string) - base64 ThumbHash */
+type placeholderJSON struct {
+	File      string `json:"file"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	BlurHash  string `json:"blurhash"`
+	ThumbHash string `json:"thumbhash"`
+}
+
+// runPlaceholder() - print the BlurHash and ThumbHash of existing images
+/* args ([]string) - arguments after the subcommand name; w (io.Writer) - where to print the hashes */
+func runPlaceholder(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("placeholder", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print one JSON object per image")
+	if err := parseCommandFlags(fs, "gitfit placeholder [-json] <image>...", args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no images given")
+	}
+
+	enc := json.NewEncoder(w)
+	for _, path := range fs.Args() {
+		p, bounds, err := compressor.PlaceholderFile(path)
+		if err != nil {
+			return err
+		}
+
+		if *asJSON {
+			if err := enc.Encode(placeholderJSON{File: path, Width: bounds.Dx(), Height: bounds.Dy(), BlurHash: p.BlurHash, ThumbHash: p.ThumbHash}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fmt.Fprintf(w, "%s (%dx%d)\n", path, bounds.Dx(), bounds.Dy())
+		printPlaceholder(w, &p)
+	}
+
+	return nil
+}
+
+// printPlaceholder() - print placeholder hashes, one per line
+/* w (io.Writer) - destination; p (*compressor.Placeholder) - hashes to print */
+func printPlaceholder(w io.Writer, p *compressor.Placeholder) {
+	fmt.Fprintf(w, "BlurHash:  %s\n", p.BlurHash)
+	fmt.Fprintf(w, "ThumbHash: %s\n", p.ThumbHash)
+}
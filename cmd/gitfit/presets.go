@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// preset is a named set of compress flag values for a common destination
+/* Name (string) - value for -preset; Description (string) - what the preset is for
+   Flags (map[string]string) - flag values applied unless given on the command line */
+type preset struct {
+	Name        string
+	Description string
+	Flags       map[string]string
+}
+
+// presets are the built-in presets, listed by `gitfit presets`
+var presets = []preset{
+	{"gravatar", "Gravatar avatar: square, JPEG under 1 MB", map[string]string{"crop": "smart", "format": "jpeg", "maxsize": "1MiB", "safezone": "true"}},
+	{"github", "GitHub profile picture: square, PNG under 1 MB", map[string]string{"crop": "smart", "format": "png", "maxsize": "1MiB", "safezone": "true"}},
+	{"email", "Email signature photo: square, JPEG under 50 KB", map[string]string{"crop": "center", "format": "jpeg", "maxsize": "50KiB", "quality": "80"}},
+	{"favicon", "Site icon: multi-size ICO under 100 KB", map[string]string{"crop": "center", "format": "ico", "maxsize": "100KiB"}},
+	{"web", "Inline web image: JPEG under 200 KB", map[string]string{"format": "jpeg", "maxsize": "200KiB", "quality": "82"}},
+}
+
+// lookupPreset() - find a built-in preset by name
+/* name (string) - preset name */
+func lookupPreset(name string) (preset, bool) {
+	for _, p := range presets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+
+	return preset{}, false
+}
+
+// runPresets() - list the built-in presets and the flags they set
+/* args ([]string) - presets takes no arguments */
+func runPresets(args []string) error {
+	fs := flag.NewFlagSet("presets", flag.ContinueOnError)
+	if err := parseCommandFlags(fs, "gitfit presets", args); err != nil {
+		return err
+	}
+
+	for _, p := range presets {
+		names := make([]string, 0, len(p.Flags))
+		for name := range p.Flags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		flags := make([]string, len(names))
+		for i, name := range names {
+			flags[i] = fmt.Sprintf("-%s %s", name, p.Flags[name])
+		}
+
+		fmt.Fprintf(stdout, "%-10s %s\n", p.Name, p.Description)
+		fmt.Fprintf(stdout, "%-10s %s\n", "", strings.Join(flags, " "))
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"image"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nabiladem/git-fit/internal/compressor"
+)
+
+// error codes of -json reports, scripts match on them so they must not change
+const (
+	codeInvalidArguments  = "invalid_arguments"
+	codeInputNotFound     = "input_not_found"
+	codeOutputExists      = "output_exists"
+	codeUnsupportedInput  = "unsupported_input"
+	codeTargetUnreachable = "target_unreachable"
+	codeUploadFailed      = "upload_failed"
+	codeDownloadFailed    = "download_failed"
+	codeCompressFailed    = "compress_failed"
+)
+
+// errReported reports that a failure was already written as a -json report, main() exits non-zero without another message
+var errReported = errors.New("reported")
+
+// jsonOut receives -json reports, nil when -json is off; jsonMu keeps concurrent batch workers from interleaving lines
+var (
+	jsonOut io.Writer
+	jsonMu  sync.Mutex
+)
+
+// codedError attaches a -json error code to an error
+/* Code (string) - one of the code* constants; Err (error) - underlying error */
+type codedError struct {
+	Code string
+	Err  error
+}
+
+// Error() - return the message of the underlying error
+// e (*codedError) - error to describe
+func (e *codedError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap() - return the underlying error
+// e (*codedError) - error to unwrap
+func (e *codedError) Unwrap() error {
+	return e.Err
+}
+
+// withCode() - attach an error code, keeping a more specific code attached earlier
+/* code (string) - error code; err (error) - error to wrap, nil stays nil */
+func withCode(code string, err error) error {
+	var coded *codedError
+	if err == nil || errors.As(err, &coded) {
+		return err
+	}
+
+	return &codedError{Code: code, Err: err}
+}
+
+// errorCode() - stable code of an error for -json reports
+/* err (error) - error to classify */
+func errorCode(err error) string {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+
+	var unreachable *compressor.UnreachableError
+	if errors.As(err, &unreachable) {
+		return codeTargetUnreachable
+	}
+
+	if errors.Is(err, compressor.ErrDecode) || errors.Is(err, image.ErrFormat) {
+		return codeUnsupportedInput
+	}
+
+	return codeCompressFailed
+}
+
+// compressReport is the -json output for one input
+/* Status (string) - ok, planned (dry run), skipped or error; Input, Output (string) - as given, - for stdin and stdout
+   InputSize (int64) - input bytes; OutputSize (int) - output bytes; Width, Height (int) - output dimensions
+   Format (string) - output format; Quality (int) - encoder quality used; SSIM, PSNR (float64) - quality against the input
+   Reachable (*bool) - whether the size cap was met, only for results; DurationMS (int64) - time spent compressing
+   Warnings ([]string) - compressor warnings; BlurHash, ThumbHash (string) - placeholders with -placeholder
+   Gravatar (*gravatarReport) - upload status with -upload-gravatar; SkipReason (string) - why a batch input was left alone
+   Error (*errorReport) - what went wrong when Status is error */
+type compressReport struct {
+	Status     string          `json:"status"`
+	Input      string          `json:"input"`
+	Output     string          `json:"output,omitempty"`
+	InputSize  int64           `json:"input_size,omitempty"`
+	OutputSize int             `json:"output_size,omitempty"`
+	Width      int             `json:"width,omitempty"`
+	Height     int             `json:"height,omitempty"`
+	Format     string          `json:"format,omitempty"`
+	Quality    int             `json:"quality,omitempty"`
+	SSIM       float64         `json:"ssim,omitempty"`
+	PSNR       float64         `json:"psnr,omitempty"`
+	Reachable  *bool           `json:"reachable,omitempty"`
+	DurationMS int64           `json:"duration_ms"`
+	Warnings   []string        `json:"warnings,omitempty"`
+	BlurHash   string          `json:"blurhash,omitempty"`
+	ThumbHash  string          `json:"thumbhash,omitempty"`
+	Gravatar   *gravatarReport `json:"gravatar,omitempty"`
+	SkipReason string          `json:"skip_reason,omitempty"`
+	Error      *errorReport    `json:"error,omitempty"`
+}
+
+// errorReport is the error of a failed -json report
+/* Code (string) - stable error code; Message (string) - human-readable message */
+type errorReport struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// gravatarReport is the Gravatar upload status of a -json report
+/* Uploaded (bool) - whether the avatar was set; Error (string) - why the upload failed */
+type gravatarReport struct {
+	Uploaded bool   `json:"uploaded"`
+	Error    string `json:"error,omitempty"`
+}
+
+// newReport() - describe a compression result
+/* input, output (string) - paths as given by the user; inputPath (string) - file the input was read from
+   result (*compressor.Result) - compression result; dryRun (bool) - nothing was written; elapsed (time.Duration) - compression time */
+func newReport(input, output, inputPath string, result *compressor.Result, dryRun bool, elapsed time.Duration) compressReport {
+	status := "ok"
+	if dryRun {
+		status = "planned"
+	}
+
+	reachable := result.Reachable
+	r := compressReport{
+		Status:     status,
+		Input:      input,
+		Output:     output,
+		InputSize:  fileSize(inputPath),
+		OutputSize: result.Size,
+		Width:      result.Width,
+		Height:     result.Height,
+		Format:     result.Format,
+		Quality:    result.Quality,
+		SSIM:       result.SSIM,
+		PSNR:       result.PSNR,
+		Reachable:  &reachable,
+		DurationMS: elapsed.Milliseconds(),
+		Warnings:   result.Warnings,
+	}
+
+	if result.Placeholder != nil {
+		r.BlurHash, r.ThumbHash = result.Placeholder.BlurHash, result.Placeholder.ThumbHash
+	}
+
+	return r
+}
+
+// batchReport() - describe the outcome of one batch input
+/* r (batchResult) - outcome; dryRun (bool) - nothing was written */
+func batchReport(r batchResult, dryRun bool) compressReport {
+	switch {
+	case r.Err != nil:
+		return compressReport{Status: "error", Input: r.Input, InputSize: fileSize(r.Input), DurationMS: r.Elapsed.Milliseconds(),
+			Error: &errorReport{Code: errorCode(r.Err), Message: r.Err.Error()}}
+	case r.Skipped != "":
+		return compressReport{Status: "skipped", Input: r.Input, Output: r.Output, InputSize: fileSize(r.Input), SkipReason: r.Skipped}
+	}
+
+	return newReport(r.Input, r.Output, r.Input, r.Result, dryRun, r.Elapsed)
+}
+
+// fileSize() - size of a file in bytes, 0 when it cannot be read
+/* path (string) - file path */
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+
+	return info.Size()
+}
+
+// writeReport() - print one -json report as a line of its own
+/* r (compressReport) - report to print */
+func writeReport(r compressReport) error {
+	jsonMu.Lock()
+	defer jsonMu.Unlock()
+
+	return json.NewEncoder(jsonOut).Encode(r)
+}
+
+// inputName() - the input as the user gave it, for reports
+/* cfg (*Config) - configuration of the run */
+func inputName(cfg *Config) string {
+	return cmp.Or(cfg.InputName, cfg.InputPath)
+}
+
+// reportFailure() - under -json, print err as an error report and return errReported, otherwise return err
+/* cfg (*Config) - configuration of the failed run; err (error) - what went wrong */
+func reportFailure(cfg *Config, err error) error {
+	if jsonOut == nil || errors.Is(err, errReported) {
+		return err
+	}
+
+	if werr := writeReport(compressReport{Status: "error", Input: inputName(cfg), Output: cfg.OutputPath,
+		Error: &errorReport{Code: errorCode(err), Message: err.Error()}}); werr != nil {
+		return werr
+	}
+
+	return errReported
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nabiladem/git-fit/internal/compressor"
+	"github.com/nabiladem/git-fit/internal/gravatar"
+)
+
+// watchUsage is the usage line of the watch command
+const watchUsage = "gitfit watch -output <dir> [-preset <name>] [-interval 1s] [-settle 2s] [-existing] [-upload-gravatar] [compress flags] <dir>"
+
+// watchOptions are the settings of the watch command on top of the compress flags
+/* Dir (string) - folder to watch; Interval (time.Duration) - time between scans
+   Settle (time.Duration) - how long a file must stay unchanged before it is compressed
+   Existing (bool) - also compress the images already in the folder at start */
+type watchOptions struct {
+	Dir      string
+	Interval time.Duration
+	Settle   time.Duration
+	Existing bool
+}
+
+// watchedFile is what the last scans saw of one file
+/* size (int64) - file size; modTime (time.Time) - modification time
+   since (time.Time) - when size or modTime last changed; done (bool) - compressed since the last change */
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+	done    bool
+}
+
+// runWatch() - compress images dropped into a folder until interrupted
+/* args ([]string) - compress and watch flags followed by the folder */
+func runWatch(args []string) error {
+	fs, build := newCompressFlagSet(flag.ContinueOnError)
+	interval := fs.Duration("interval", time.Second, "Time between scans of the folder")
+	settle := fs.Duration("settle", 2*time.Second, "How long a file must stay unchanged before it is compressed, so half-written files are left alone")
+	existing := fs.Bool("existing", false, "Also compress the images already in the folder at start")
+	if err := parseCommandFlags(fs, watchUsage, args); err != nil {
+		return err
+	}
+
+	if err := applySettings(fs); err != nil {
+		return err
+	}
+
+	cfg := build()
+	w := watchOptions{Interval: *interval, Settle: *settle, Existing: *existing}
+
+	switch {
+	case fs.NArg() == 1 && cfg.InputPath == "":
+		w.Dir = fs.Arg(0)
+	case fs.NArg() == 0 && cfg.InputPath != "":
+		w.Dir = cfg.InputPath
+	default:
+		fs.Usage()
+		return errUsage
+	}
+
+	if err := validateWatch(cfg, w); err != nil {
+		return err
+	}
+
+	if cfg.JSON {
+		defer func(out io.Writer) { stdout, jsonOut = out, nil }(stdout)
+		jsonOut, stdout = stdout, os.Stderr
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	return watchDir(ctx, cfg, w)
+}
+
+// validateWatch() - check the settings of a watch run
+/* cfg (*Config) - compress settings; w (watchOptions) - watch settings */
+func validateWatch(cfg *Config, w watchOptions) error {
+	if info, err := os.Stat(w.Dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", w.Dir)
+	}
+
+	if cfg.OutputPath == "" || cfg.OutputPath == stdioPath {
+		return fmt.Errorf("watch needs an -output directory")
+	}
+
+	// outputs written into the watched folder would be picked up again
+	dir, _ := filepath.Abs(w.Dir)
+	out, _ := filepath.Abs(cfg.OutputPath)
+	if dir == out {
+		return fmt.Errorf("-output must be a different directory than the watched one")
+	}
+
+	if info, err := os.Stat(cfg.OutputPath); err == nil && !info.IsDir() {
+		return fmt.Errorf("-output must be a directory")
+	}
+
+	if cfg.Variants != "" || cfg.Srcset != "" || cfg.CirclePreview != "" || cfg.Manifest != "" || cfg.Resume != "" || cfg.DryRun {
+		return fmt.Errorf("watch cannot be combined with -variants, -srcset, -circle-preview, -manifest, -resume or -dry-run")
+	}
+
+	if w.Interval <= 0 || w.Settle < 0 {
+		return fmt.Errorf("-interval must be positive and -settle must not be negative")
+	}
+
+	if cfg.Preset != "" {
+		if _, ok := lookupPreset(cfg.Preset); !ok {
+			return fmt.Errorf("unknown preset %q, run 'gitfit presets' to list them", cfg.Preset)
+		}
+	}
+
+	if cfg.OutputFormat != "" {
+		enc, ok := compressor.LookupEncoder(cfg.OutputFormat)
+		if !ok {
+			return fmt.Errorf("unsupported output format: %s. Supported formats are: %s",
+				cfg.OutputFormat, strings.Join(compressor.FormatNames(), ", "))
+		}
+		cfg.OutputFormat = enc.Name()
+	}
+
+	// a percentage cap is resolved per file once its size is known
+	if cfg.MaxSize <= 0 && cfg.MaxSizePercent <= 0 {
+		return fmt.Errorf("max size must be greater than 0")
+	}
+
+	if cfg.Quality <= 0 || cfg.Quality > 100 {
+		return fmt.Errorf("value for -quality must be between 1 and 100 inclusive")
+	}
+
+	if err := validateNameTemplate(cfg); err != nil {
+		return err
+	}
+
+	_, err := compressOptions(cfg)
+	return err
+}
+
+// watchDir() - scan the folder every interval and compress files once they settle, until ctx is done
+/* ctx (context.Context) - stops the watch; cfg (*Config) - compress settings; w (watchOptions) - watch settings */
+func watchDir(ctx context.Context, cfg *Config, w watchOptions) error {
+	opts, err := compressOptions(cfg)
+	if err != nil {
+		return err
+	}
+	opts.Verbose = false
+
+	if err := os.MkdirAll(cfg.OutputPath, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	// sign in before the first file arrives rather than in the middle of the watch
+	var client *gravatar.Client
+	if cfg.UploadGravatar {
+		if client, err = gravatarClient(cfg.Verbose); err != nil {
+			return err
+		}
+	}
+
+	// a changed source replaces the output it produced earlier
+	cfg.Force = cfg.Force || !cfg.Backup
+
+	fmt.Fprintf(stdout, "Watching %s every %s, writing to %s (Ctrl-C to stop)\n", w.Dir, w.Interval, cfg.OutputPath)
+
+	files := map[string]*watchedFile{}
+	first, count := true, 0
+
+	// two sources can still collide on a name template
+	claimed := map[string]string{}
+	claim := func(output, input string) error {
+		if other, ok := claimed[output]; ok && other != input {
+			return fmt.Errorf("output %s is also produced by %s; add {format} or {width} to -name", output, other)
+		}
+		claimed[output] = input
+		return nil
+	}
+
+	for {
+		inputs, err := expandInputs(w.Dir)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		present := map[string]bool{}
+		for _, input := range inputs {
+			info, err := os.Stat(input)
+			if err != nil {
+				continue
+			}
+			present[input] = true
+
+			f, ok := files[input]
+			switch {
+			case !ok:
+				// files there before the watch started count as done unless -existing
+				files[input] = &watchedFile{size: info.Size(), modTime: info.ModTime(), since: now, done: first && !w.Existing}
+			case f.size != info.Size() || !f.modTime.Equal(info.ModTime()):
+				f.size, f.modTime, f.since, f.done = info.Size(), info.ModTime(), now, false
+			case !f.done && now.Sub(f.since) >= w.Settle:
+				f.done = true
+				count++
+				processWatched(cfg, opts, client, input, count, claim)
+			}
+		}
+
+		// forget deleted files, so a file dropped in again under the same name is new
+		for input := range files {
+			if !present[input] {
+				delete(files, input)
+			}
+		}
+		first = false
+
+		select {
+		case <-ctx.Done():
+			fmt.Fprintf(stdout, "Stopped watching %s after %d files\n", w.Dir, count)
+			return nil
+		case <-time.After(w.Interval):
+		}
+	}
+}
+
+// processWatched() - compress one settled file, upload it when asked, and log the outcome
+/* cfg (*Config) - compress settings; opts (compressor.Options) - shared compressor options
+   client (*gravatar.Client) - signed-in client with -upload-gravatar, nil otherwise; input (string) - settled file
+   index (int) - running number, keeps temp names unique; claim (func(string, string) error) - reserves an output path */
+func processWatched(cfg *Config, opts compressor.Options, client *gravatar.Client, input string, index int, claim func(string, string) error) {
+	r := compressOne(cfg, opts, input, index, claim)
+
+	var uploadErr error
+	uploaded := client != nil && r.Err == nil && r.Skipped == ""
+	if uploaded {
+		uploadErr = client.UploadAvatar(r.Output)
+	}
+
+	if cfg.JSON {
+		report := batchReport(r, false)
+		if uploaded {
+			report.Gravatar = &gravatarReport{Uploaded: uploadErr == nil}
+			if uploadErr != nil {
+				report.Gravatar.Error = uploadErr.Error()
+			}
+		}
+		writeReport(report)
+		return
+	}
+
+	fmt.Fprintf(stdout, "%s ", time.Now().Format("15:04:05"))
+	printBatchResult(r)
+
+	switch {
+	case uploaded && uploadErr != nil:
+		fmt.Fprintf(stdout, "FAIL  uploading %s to Gravatar: %v\n", r.Output, uploadErr)
+	case uploaded:
+		fmt.Fprintf(stdout, "      uploaded %s to Gravatar\n", r.Output)
+	}
+}
@@ -0,0 +1,318 @@
+package compressor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Knob describes a tunable encoder setting
+/* Name (string) - setting name, e.g. quality; Description (string) - short help text
+   Min (int) - lowest accepted value; Max (int) - highest accepted value; Default (int) - value used when unset */
+type Knob struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Min         int    `json:"min"`
+	Max         int    `json:"max"`
+	Default     int    `json:"default"`
+}
+
+// EncodeOptions holds the knob values passed to an Encoder
+/* Quality (int) - value of the quality knob, ignored by encoders without one */
+type EncodeOptions struct {
+	Quality int
+}
+
+// Encoder writes images in one output format
+/* Name() - canonical format name used by -format and the form field
+   Extensions() - file extensions including the dot, the first one is used for new files
+   MIMEType() - content type of the encoded data
+   SupportsAlpha() - whether transparency is preserved
+   SupportsAnimation() - whether the format can hold more than one frame
+   Knobs() - tunable settings the encoder honors
+   Encode() - encode img to w */
+type Encoder interface {
+	Name() string
+	Extensions() []string
+	MIMEType() string
+	SupportsAlpha() bool
+	SupportsAnimation() bool
+	Knobs() []Knob
+	Encode(w io.Writer, img image.Image, opts EncodeOptions) error
+}
+
+// WidthLimiter is implemented by encoders that only produce a range of widths, such as icons
+/* WidthLimits() - smallest and largest width the size search may try */
+type WidthLimiter interface {
+	WidthLimits() (int, int)
+}
+
+// Decoder reads images in one input format
+/* Name() - format name; Extensions() - file extensions including the dot
+   Match() - report whether the leading bytes of a file belong to this format
+   Decode() - decode an image from r */
+type Decoder interface {
+	Name() string
+	Extensions() []string
+	Match(header []byte) bool
+	Decode(r io.Reader) (image.Image, error)
+}
+
+// sniffLen is how many leading bytes are handed to Decoder.Match(), enough for an SVG's prolog, comments and doctype
+const sniffLen = 512
+
+// registry holds the registered encoders and decoders, keyed by lowercase name
+var registry = struct {
+	sync.RWMutex
+	encoders map[string]Encoder
+	aliases  map[string]string
+	decoders []Decoder
+}{
+	encoders: map[string]Encoder{},
+	aliases:  map[string]string{},
+}
+
+// RegisterEncoder() - make an output format available, replacing any encoder with the same name
+/* enc (Encoder) - encoder to register; aliases ([]string) - extra names accepted for the format, e.g. jpg */
+func RegisterEncoder(enc Encoder, aliases ...string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	name := strings.ToLower(enc.Name())
+	registry.encoders[name] = enc
+	for _, alias := range aliases {
+		registry.aliases[strings.ToLower(alias)] = name
+	}
+}
+
+// RegisterDecoder() - make an input format available, later registrations are tried first
+/* dec (Decoder) - decoder to register */
+func RegisterDecoder(dec Decoder) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.decoders = append([]Decoder{dec}, registry.decoders...)
+}
+
+// LookupEncoder() - find the encoder for a format name or alias, case-insensitive
+/* name (string) - format name such as jpeg, jpg or png */
+func LookupEncoder(name string) (Encoder, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	if canonical, ok := registry.aliases[name]; ok {
+		name = canonical
+	}
+
+	enc, ok := registry.encoders[name]
+	return enc, ok
+}
+
+// EncoderForExtension() - find the encoder that writes files with the given extension
+/* ext (string) - file extension with or without the leading dot */
+func EncoderForExtension(ext string) (Encoder, bool) {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	for _, enc := range Encoders() {
+		for _, e := range enc.Extensions() {
+			if e == ext {
+				return enc, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// Encoders() - list the registered encoders sorted by name
+func Encoders() []Encoder {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	encoders := make([]Encoder, 0, len(registry.encoders))
+	for _, enc := range registry.encoders {
+		encoders = append(encoders, enc)
+	}
+
+	sort.Slice(encoders, func(i, j int) bool { return encoders[i].Name() < encoders[j].Name() })
+	return encoders
+}
+
+// FormatNames() - list the names of the registered output formats, sorted
+func FormatNames() []string {
+	var names []string
+	for _, enc := range Encoders() {
+		names = append(names, enc.Name())
+	}
+
+	return names
+}
+
+// HasKnob() - report whether an encoder honors the named knob
+/* enc (Encoder) - encoder to check; name (string) - knob name */
+func HasKnob(enc Encoder, name string) bool {
+	for _, k := range enc.Knobs() {
+		if k.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DecodeImage() - decode an image with the first registered decoder whose signature matches, returns the image and format name
+/* r (io.Reader) - encoded image data */
+func DecodeImage(r io.Reader) (image.Image, string, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", err
+	}
+
+	registry.RLock()
+	decoders := registry.decoders
+	registry.RUnlock()
+
+	for _, dec := range decoders {
+		if dec.Match(header) {
+			img, err := dec.Decode(br)
+			return img, dec.Name(), err
+		}
+	}
+
+	// fall back to anything registered with the standard library
+	return image.Decode(br)
+}
+
+// DetectFormat() - identify the format of an image file from its leading bytes, returns the decoder name
+/* path (string) - image file to inspect */
+func DetectFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, dec := range registry.decoders {
+		if dec.Match(header[:n]) {
+			return dec.Name(), nil
+		}
+	}
+
+	return "", fmt.Errorf("unrecognized image format in %s", path)
+}
+
+// encodeWith() - encode img with the encoder registered for format into a new buffer
+/* img (image.Image) - image to encode; format (string) - format name; opts (EncodeOptions) - knob values */
+func encodeWith(img image.Image, format string, opts EncodeOptions) (*bytes.Buffer, error) {
+	enc, ok := LookupEncoder(format)
+	if !ok {
+		return nil, fmt.Errorf("unsupported file format: %v. Supported formats are: %s", format, strings.Join(FormatNames(), ", "))
+	}
+
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, img, opts); err != nil {
+		return nil, fmt.Errorf("failed to encode image as %s: %v", enc.Name(), err)
+	}
+
+	return &buf, nil
+}
+
+// qualityKnob is shared by the lossy encoders
+var qualityKnob = Knob{Name: "quality", Description: "compression quality, higher is larger and sharper", Min: 1, Max: 100, Default: 85}
+
+// jpegCodec encodes and decodes baseline JPEG
+type jpegCodec struct{}
+
+func (jpegCodec) Name() string                            { return "jpeg" }
+func (jpegCodec) Extensions() []string                    { return []string{".jpg", ".jpeg"} }
+func (jpegCodec) MIMEType() string                        { return "image/jpeg" }
+func (jpegCodec) SupportsAlpha() bool                     { return false }
+func (jpegCodec) SupportsAnimation() bool                 { return false }
+func (jpegCodec) Knobs() []Knob                           { return []Knob{qualityKnob} }
+func (jpegCodec) Match(header []byte) bool                { return bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}) }
+func (jpegCodec) Decode(r io.Reader) (image.Image, error) { return jpeg.Decode(r) }
+
+// Encode() - write img as JPEG, out-of-range qualities fall back to the knob default
+// (jpegCodec) - JPEG codec
+func (jpegCodec) Encode(w io.Writer, img image.Image, opts EncodeOptions) error {
+	quality := opts.Quality
+	if quality < qualityKnob.Min || quality > qualityKnob.Max {
+		quality = qualityKnob.Default
+	}
+
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+}
+
+// pngCodec encodes and decodes lossless PNG
+type pngCodec struct{}
+
+func (pngCodec) Name() string            { return "png" }
+func (pngCodec) Extensions() []string    { return []string{".png"} }
+func (pngCodec) MIMEType() string        { return "image/png" }
+func (pngCodec) SupportsAlpha() bool     { return true }
+func (pngCodec) SupportsAnimation() bool { return false }
+func (pngCodec) Knobs() []Knob           { return nil }
+func (pngCodec) Match(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n"))
+}
+func (pngCodec) Decode(r io.Reader) (image.Image, error) { return png.Decode(r) }
+
+// Encode() - write img as PNG
+// (pngCodec) - PNG codec
+func (pngCodec) Encode(w io.Writer, img image.Image, _ EncodeOptions) error {
+	return png.Encode(w, img)
+}
+
+// gifCodec encodes and decodes GIF, decoding keeps the first frame
+type gifCodec struct{}
+
+func (gifCodec) Name() string            { return "gif" }
+func (gifCodec) Extensions() []string    { return []string{".gif"} }
+func (gifCodec) MIMEType() string        { return "image/gif" }
+func (gifCodec) SupportsAlpha() bool     { return true }
+func (gifCodec) SupportsAnimation() bool { return true }
+func (gifCodec) Knobs() []Knob           { return nil }
+func (gifCodec) Match(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("GIF87a")) || bytes.HasPrefix(header, []byte("GIF89a"))
+}
+func (gifCodec) Decode(r io.Reader) (image.Image, error) { return gif.Decode(r) }
+
+// Encode() - write img as a single-frame GIF with a full 256-color palette
+// (gifCodec) - GIF codec
+func (gifCodec) Encode(w io.Writer, img image.Image, _ EncodeOptions) error {
+	return gif.Encode(w, img, &gif.Options{NumColors: 256}) // fidelity
+}
+
+// init() - register the built-in formats
+func init() {
+	RegisterEncoder(jpegCodec{}, "jpg")
+	RegisterEncoder(pngCodec{})
+	RegisterEncoder(gifCodec{})
+
+	RegisterDecoder(gifCodec{})
+	RegisterDecoder(pngCodec{})
+	RegisterDecoder(jpegCodec{})
+}
@@ -0,0 +1,104 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"slices"
+	"testing"
+)
+
+// TestLookupEncoder() - test lookups by name, alias and extension
+/* t (*testing.T) - testing object */
+func TestLookupEncoder(t *testing.T) {
+	for _, name := range []string{"jpeg", "JPG", " png ", "gif"} {
+		if _, ok := LookupEncoder(name); !ok {
+			t.Errorf("expected encoder for %q", name)
+		}
+	}
+
+	if _, ok := LookupEncoder("bmp2"); ok {
+		t.Error("expected no encoder for bmp2")
+	}
+
+	enc, ok := EncoderForExtension(".JPEG")
+	if !ok || enc.Name() != "jpeg" {
+		t.Errorf("expected jpeg encoder for .JPEG, got %v", enc)
+	}
+
+	if enc, ok := EncoderForExtension("png"); !ok || enc.MIMEType() != "image/png" {
+		t.Errorf("expected png encoder for png, got %v", enc)
+	}
+
+	jpegEnc, _ := LookupEncoder("jpeg")
+	pngEnc, _ := LookupEncoder("png")
+	if !HasKnob(jpegEnc, "quality") || HasKnob(pngEnc, "quality") {
+		t.Error("expected only jpeg to expose a quality knob")
+	}
+}
+
+// testEncoder is a stand-in format used to check that registered encoders are picked up
+type testEncoder struct{}
+
+func (testEncoder) Name() string            { return "testfmt" }
+func (testEncoder) Extensions() []string    { return []string{".tst"} }
+func (testEncoder) MIMEType() string        { return "image/x-test" }
+func (testEncoder) SupportsAlpha() bool     { return true }
+func (testEncoder) SupportsAnimation() bool { return false }
+func (testEncoder) Knobs() []Knob           { return nil }
+func (testEncoder) Encode(w io.Writer, img image.Image, _ EncodeOptions) error {
+	_, err := w.Write([]byte("TEST"))
+	return err
+}
+
+// TestRegisterEncoder() - test that a registered encoder is listed and used for compression
+/* t (*testing.T) - testing object */
+func TestRegisterEncoder(t *testing.T) {
+	RegisterEncoder(testEncoder{}, "tst")
+	defer func() {
+		registry.Lock()
+		delete(registry.encoders, "testfmt")
+		delete(registry.aliases, "tst")
+		registry.Unlock()
+	}()
+
+	if !slices.Contains(FormatNames(), "testfmt") {
+		t.Errorf("expected testfmt in %v", FormatNames())
+	}
+
+	buf, err := encodeResizedToBuffer(image.NewRGBA(image.Rect(0, 0, 10, 10)), 5, "tst", 0)
+	if err != nil {
+		t.Fatalf("encode via alias failed: %v", err)
+	}
+
+	if buf.String() != "TEST" {
+		t.Errorf("expected custom encoder output, got %q", buf.String())
+	}
+}
+
+// TestDecodeImage_Sniffing() - test that decoding picks the format from the content
+/* t (*testing.T) - testing object */
+func TestDecodeImage_Sniffing(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	img.Set(1, 1, color.RGBA{255, 0, 0, 255})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png encode: %v", err)
+	}
+
+	decoded, format, err := DecodeImage(&buf)
+	if err != nil {
+		t.Fatalf("DecodeImage failed: %v", err)
+	}
+
+	if format != "png" || decoded.Bounds().Dx() != 4 {
+		t.Errorf("expected 4px wide png, got %s %v", format, decoded.Bounds())
+	}
+
+	if _, _, err := DecodeImage(bytes.NewReader([]byte("not an image"))); err == nil {
+		t.Error("expected error for unknown data")
+	}
+}
@@ -2,70 +2,399 @@ package compressor
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"image"
-	"image/gif"
-	"image/jpeg"
-	"image/png"
+	"io"
+	"math"
 	"os"
 
 	"github.com/disintegration/imaging"
 )
 
+// LogOutput receives the progress printed when Options.Verbose is set; the CLI points it at stderr
+// when the image itself goes to stdout
+var LogOutput io.Writer = os.Stdout
+
+// ErrDecode is wrapped by errors for input that cannot be decoded as an image
+var ErrDecode = errors.New("failed to decode image")
+
+// Options holds the settings for a single compression run
+/* MaxSize (int) - maximum size of the image in bytes; OutputFormat (string) - jpeg, png, or gif
+   Quality (int) - quality for JPEG compression; Verbose (bool) - enable verbose logging
+   Crop (CropSpec) - optional square crop or pad applied before the size search
+   MinSSIM (float64) - when > 0, find the smallest output whose SSIM against the source is at least this value
+   instead of the largest width under MaxSize; MaxSize still caps the result unless it is 0
+   DryRun (bool) - run the search and report the plan without writing the output
+   SVGSize (int) - longest side SVG input is rasterized at, DefaultSVGSize when 0
+   Placeholder (bool) - also compute a BlurHash and a ThumbHash of the output
+   SafeZone (bool) - measure the detail a circular avatar mask hides and warn when it is a lot, for avatar outputs */
+type Options struct {
+	MaxSize      int
+	OutputFormat string
+	Quality      int
+	Verbose      bool
+	Crop         CropSpec
+	MinSSIM      float64
+	DryRun       bool
+	SVGSize      int
+	Placeholder  bool
+	SafeZone     bool
+}
+
+// Result describes the image produced by a compression run
+/* Width (int) - output width in pixels; Height (int) - output height in pixels
+   Size (int) - output size in bytes; Format (string) - output format
+   Quality (int) - JPEG quality used; CropRect (image.Rectangle) - region of the source that was kept
+   SafeZone (SafeZoneReport) - how much detail falls outside a circular avatar mask, zero unless Options.SafeZone
+   SSIM (float64) - structural similarity between source and output, 1 means identical
+   PSNR (float64) - peak signal-to-noise ratio between source and output in dB
+   Reachable (bool) - whether the target was met; only false for dry runs, which report the closest attempt
+   Placeholder (*Placeholder) - BlurHash and ThumbHash of the output, nil unless requested
+   Warnings ([]string) - non-fatal problems worth showing to the user */
+type Result struct {
+	Width       int
+	Height      int
+	Size        int
+	Format      string
+	Quality     int
+	CropRect    image.Rectangle
+	SafeZone    SafeZoneReport
+	SSIM        float64
+	PSNR        float64
+	Reachable   bool
+	Placeholder *Placeholder
+	Warnings    []string
+}
+
+// UnreachableError reports that no output meets the requested size or quality target
+type UnreachableError struct {
+	Reason string
+}
+
+// Error() - return the reason the target could not be met
+// e (*UnreachableError) - error to describe
+func (e *UnreachableError) Error() string {
+	return e.Reason
+}
+
 // CompressImage() - compress image to the target size
 /* inputPath (string) - path of the input image; outputPath (string) - path of the output image
    maxSize (int) - maximum size of the image in bytes; outputFormat (string) - jpeg, png, or gif
    quality (int) - quality for JPEG compression; verbose (bool) - enable verbose logging */
 func CompressImage(inputPath string, outputPath string, maxSize int, outputFormat string, quality int, verbose bool) error {
+	_, err := Compress(inputPath, outputPath, Options{
+		MaxSize:      maxSize,
+		OutputFormat: outputFormat,
+		Quality:      quality,
+		Verbose:      verbose,
+	})
+
+	return err
+}
+
+// Compress() - compress image to the target size using the given options, returns a description of the output
+/* inputPath (string) - path of the input image; outputPath (string) - path of the output image
+   opts (Options) - compression settings */
+func Compress(inputPath string, outputPath string, opts Options) (*Result, error) {
 	const MinWidth = 100
 
-	if verbose {
-		fmt.Println("Starting compression...")
+	if opts.Verbose {
+		fmt.Fprintln(LogOutput, "Starting compression...")
+	}
+
+	// report aliases such as jpg under their canonical name
+	if enc, ok := LookupEncoder(opts.OutputFormat); ok {
+		opts.OutputFormat = enc.Name()
+	}
+
+	if err := CheckPadAlpha(opts.Crop, opts.OutputFormat); err != nil {
+		return nil, err
+	}
+
+	img, crop, err := prepareSource(inputPath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	width := img.Bounds().Dx()
+	minWidth := MinWidth
+
+	// some formats only cover a range of sizes
+	if enc, ok := LookupEncoder(opts.OutputFormat); ok {
+		if limiter, ok := enc.(WidthLimiter); ok {
+			minWidth, width = limiter.WidthLimits()
+			width = min(width, img.Bounds().Dx())
+		}
+	}
+
+	if width < minWidth {
+		minWidth = width
+	}
+
+	quality := opts.Quality
+	var best int
+	var buf *bytes.Buffer
+	if opts.MinSSIM > 0 {
+		best, quality, buf, err = findSmallestForSSIM(img, minWidth, width, opts)
+	} else {
+		best, buf, err = findLargestUnderSize(img, minWidth, width, opts)
+	}
+
+	// a dry run reports an unreachable target as a plan at the smallest width instead of failing
+	reachable := true
+	var unreachable *UnreachableError
+	if opts.DryRun && errors.As(err, &unreachable) {
+		reachable, best, quality = false, minWidth, opts.Quality
+		buf, err = encodeResizedToBuffer(img, best, opts.OutputFormat, quality)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Width:     best,
+		Height:    scaledHeight(img.Bounds(), best),
+		Size:      buf.Len(),
+		Format:    opts.OutputFormat,
+		Quality:   quality,
+		CropRect:  crop.Rect,
+		Reachable: reachable,
+	}
+
+	if !reachable {
+		result.Warnings = append(result.Warnings, unreachable.Error())
+	}
+
+	// circular avatar displays hide the corners, so flag avatars with detail there
+	if opts.SafeZone {
+		result.SafeZone = AnalyzeSafeZone(img)
+		if warning := result.SafeZone.Warning(); warning != "" {
+			result.Warnings = append(result.Warnings, warning)
+		}
+
+		if opts.Verbose {
+			fmt.Fprintf(LogOutput, "Safe zone: %.1f%% of detail outside the avatar circle\n", result.SafeZone.OutsideRatio*100)
+		}
+	}
+
+	// measure how much quality the size cap cost, compared at the output size
+	// (or at the source size when a quality floor was requested, matching the search)
+	if opts.MinSSIM > 0 {
+		result.SSIM, result.PSNR, err = measureQualityAtSource(img, buf)
+	} else {
+		result.SSIM, result.PSNR, err = measureQuality(img, buf)
 	}
 
+	if err != nil {
+		result.Warnings = append(result.Warnings, err.Error())
+	} else if opts.Verbose {
+		fmt.Fprintf(LogOutput, "Quality: SSIM %.4f, PSNR %.2f dB\n", result.SSIM, result.PSNR)
+	}
+
+	if opts.Placeholder {
+		if p, err := placeholderFromBuffer(buf); err != nil {
+			result.Warnings = append(result.Warnings, err.Error())
+		} else {
+			result.Placeholder = &p
+		}
+	}
+
+	if opts.DryRun {
+		if opts.Verbose {
+			fmt.Fprintln(LogOutput, "Dry run, not writing output")
+		}
+
+		return result, nil
+	}
+
+	if opts.Verbose {
+		fmt.Fprintln(LogOutput, "Saving compressed image...")
+	}
+
+	if err := saveBufferToFile(outputPath, buf); err != nil {
+		return nil, fmt.Errorf("failed to write compressed image to file: %v", err)
+	}
+
+	return result, nil
+}
+
+// prepareSource() - load the input and apply the optional crop or pad, returns the image to compress and what was kept
+/* inputPath (string) - path of the input image; opts (Options) - compression settings */
+func prepareSource(inputPath string, opts Options) (image.Image, CropInfo, error) {
 	// load and decode image
-	img, width, err := loadImage(inputPath)
+	img, err := loadSource(inputPath, opts.SVGSize)
+	if err != nil {
+		return nil, CropInfo{}, fmt.Errorf("failed to load image: %w", err)
+	}
+
+	// optional square crop before searching for a width
+	img, crop, err := applyCrop(img, opts.Crop)
 	if err != nil {
-		return fmt.Errorf("failed to load image: %v", err)
+		return nil, CropInfo{}, fmt.Errorf("failed to crop image: %v", err)
 	}
 
+	if opts.Verbose && opts.Crop.Mode == CropPad {
+		fmt.Fprintf(LogOutput, "Padded to %dx%d square\n", img.Bounds().Dx(), img.Bounds().Dy())
+	} else if opts.Verbose && opts.Crop.Mode != CropNone {
+		fmt.Fprintf(LogOutput, "Cropped to %dx%d at (%d,%d) using %s crop\n",
+			crop.Rect.Dx(), crop.Rect.Dy(), crop.Rect.Min.X, crop.Rect.Min.Y, opts.Crop.Mode)
+	}
+
+	return img, crop, nil
+}
+
+// findLargestUnderSize() - find the largest width whose output fits in opts.MaxSize, returns the width and encoded buffer
+/* img (image.Image) - input image; minWidth (int) - minimum width; maxWidth (int) - maximum width
+   opts (Options) - compression settings */
+func findLargestUnderSize(img image.Image, minWidth, maxWidth int, opts Options) (int, *bytes.Buffer, error) {
 	// binary search to find the best width that meets maxSize
-	if verbose {
-		fmt.Println("Searching for best width (binary search)...")
+	if opts.Verbose {
+		fmt.Fprintln(LogOutput, "Searching for best width (binary search)...")
 	}
 
-	best, buf, err := findBestWidthBinarySearch(img, MinWidth, width, maxSize, outputFormat, quality, verbose)
+	best, buf, err := findBestWidthBinarySearch(img, minWidth, maxWidth, opts.MaxSize, opts.OutputFormat, opts.Quality, opts.Verbose)
 	if err != nil {
-		return err
+		return 0, nil, err
 	}
 
 	if best == 0 || buf == nil {
-		return fmt.Errorf("cannot compress image to the desired size of %d bytes", maxSize)
+		return 0, nil, &UnreachableError{Reason: fmt.Sprintf("cannot compress image to the desired size of %d bytes", opts.MaxSize)}
 	}
 
 	// linear refinement to try slightly smaller widths in steps
-	if verbose {
-		fmt.Println("Refining result (linear search)...")
+	if opts.Verbose {
+		fmt.Fprintln(LogOutput, "Refining result (linear search)...")
 	}
 
-	refinedBuf, err := linearRefine(img, best, MinWidth, maxSize, outputFormat, quality, verbose)
+	refinedWidth, refinedBuf, err := linearRefine(img, best, minWidth, opts.MaxSize, opts.OutputFormat, opts.Quality, opts.Verbose)
 	if err == nil && refinedBuf != nil {
-		buf = refinedBuf
+		best, buf = refinedWidth, refinedBuf
 	}
 
-	if buf == nil {
-		return fmt.Errorf("cannot compress image to the desired size of %d bytes", maxSize)
+	return best, buf, nil
+}
+
+// findSmallestForSSIM() - find the smallest output whose SSIM against img is at least opts.MinSSIM, searching width and quality
+/* img (image.Image) - input image; minWidth (int) - minimum width; maxWidth (int) - maximum width
+   opts (Options) - compression settings, returns the width, quality and encoded buffer */
+func findSmallestForSSIM(img image.Image, minWidth, maxWidth int, opts Options) (int, int, *bytes.Buffer, error) {
+	if opts.Verbose {
+		fmt.Fprintf(LogOutput, "Searching for smallest output with SSIM >= %.4f...\n", opts.MinSSIM)
 	}
 
-	if verbose {
-		fmt.Println("Saving compressed image...")
+	// only formats with a quality knob are searched over quality; the rest over width alone
+	enc, ok := LookupEncoder(opts.OutputFormat)
+	tunesQuality := ok && HasKnob(enc, "quality")
+
+	sizeCap := opts.MaxSize
+	if sizeCap <= 0 {
+		sizeCap = math.MaxInt
 	}
 
-	if err := saveBufferToFile(outputPath, buf); err != nil {
-		return fmt.Errorf("failed to write compressed image to file: %v", err)
+	bestWidth, bestQuality := 0, opts.Quality
+	var bestBuf *bytes.Buffer
+
+	// walk a width ladder from full size down; SSIM falls as width shrinks, so stop at the first width that cannot reach the floor
+	step := max(1, maxWidth/10)
+	for w := maxWidth; w >= minWidth; w -= step {
+		q, buf, ok, err := lowestQualityForSSIM(img, w, opts, tunesQuality)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+
+		if !ok {
+			break
+		}
+
+		if buf.Len() <= sizeCap && (bestBuf == nil || buf.Len() < bestBuf.Len()) {
+			bestWidth, bestQuality, bestBuf = w, q, buf
+		}
+
+		if w == minWidth {
+			break
+		}
+
+		if w-step < minWidth {
+			step = w - minWidth
+		}
+	}
+
+	if bestBuf == nil {
+		return 0, 0, nil, &UnreachableError{Reason: fmt.Sprintf("cannot reach SSIM %.4f within %d bytes", opts.MinSSIM, opts.MaxSize)}
+	}
+
+	return bestWidth, bestQuality, bestBuf, nil
+}
+
+// lowestQualityForSSIM() - binary search the lowest JPEG quality at width whose SSIM meets opts.MinSSIM
+/* img (image.Image) - input image; width (int) - output width; opts (Options) - compression settings
+   tunesQuality (bool) - whether to search quality or use opts.Quality as is
+   returns the quality, buffer, and whether the floor was met */
+func lowestQualityForSSIM(img image.Image, width int, opts Options, tunesQuality bool) (int, *bytes.Buffer, bool, error) {
+	try := func(q int) (*bytes.Buffer, bool, error) {
+		buf, err := encodeResizedToBuffer(img, width, opts.OutputFormat, q)
+		if err != nil {
+			return nil, false, err
+		}
+
+		score, _, err := measureQualityAtSource(img, buf)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if opts.Verbose {
+			fmt.Fprintf(LogOutput, "[ssim] Trying width: %d quality: %d -> SSIM %.4f, size %.2f KB\n", width, q, score, float64(buf.Len())/1024.0)
+		}
+
+		return buf, score >= opts.MinSSIM, nil
+	}
+
+	if !tunesQuality {
+		buf, ok, err := try(opts.Quality)
+		return opts.Quality, buf, ok, err
+	}
+
+	// the highest quality must pass for any lower one to be worth trying
+	bestBuf, ok, err := try(100)
+	if err != nil || !ok {
+		return 0, nil, false, err
+	}
+
+	best := 100
+	low, high := 1, 99
+	for low <= high {
+		mid := (low + high) / 2
+		buf, ok, err := try(mid)
+		if err != nil {
+			return 0, nil, false, err
+		}
+
+		if ok {
+			best, bestBuf = mid, buf
+			high = mid - 1
+		} else {
+			low = mid + 1
+		}
+	}
+
+	return best, bestBuf, true, nil
+}
+
+// scaledHeight() - compute the height of bounds after resizing to width while keeping the aspect ratio
+/* bounds (image.Rectangle) - original bounds; width (int) - target width */
+func scaledHeight(bounds image.Rectangle, width int) int {
+	if bounds.Dx() == 0 {
+		return 0
+	}
+
+	h := int(float64(bounds.Dy())*float64(width)/float64(bounds.Dx()) + 0.5)
+	if h < 1 {
+		h = 1
 	}
 
-	return nil
+	return h
 }
 
 // loadImage() - open and decode an image from disk and returns the image and its width
@@ -77,49 +406,53 @@ func loadImage(inputPath string) (image.Image, int, error) {
 	}
 	defer file.Close()
 
-	img, _, err := image.Decode(file)
+	img, _, err := DecodeImage(file)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to decode image from %s: %v", inputPath, err)
+		return nil, 0, fmt.Errorf("%w from %s: %v", ErrDecode, inputPath, err)
 	}
 
 	width := img.Bounds().Dx()
 	return img, width, nil
 }
 
+// loadSource() - load the input image, rasterizing SVG input at svgSize when one is given
+/* inputPath (string) - path of the input image; svgSize (int) - longest side for SVG input, 0 for the default */
+func loadSource(inputPath string, svgSize int) (image.Image, error) {
+	if svgSize <= 0 {
+		img, _, err := loadImage(inputPath)
+		return img, err
+	}
+
+	if format, err := DetectFormat(inputPath); err != nil || format != "svg" {
+		img, _, err := loadImage(inputPath)
+		return img, err
+	}
+
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %v", err)
+	}
+	defer file.Close()
+
+	return RasterizeSVG(file, svgSize)
+}
+
 // encodeResizedToBuffer() - resize an image to the target width and encodes it into a bytes.Buffer
 /* img (image.Image) - input image; width (int) - target width
-   outputFormat (string) - jpeg, png, or gif; quality (int) - JPEG quality */
+   outputFormat (string) - name of a registered encoder; quality (int) - value for the quality knob */
 func encodeResizedToBuffer(img image.Image, width int, outputFormat string, quality int) (*bytes.Buffer, error) {
 	resizedImg := imaging.Resize(img, width, 0, imaging.Lanczos)
-	var buf bytes.Buffer
-	var err error
-
-	switch outputFormat {
-	case "jpeg":
-		if quality < 1 || quality > 100 {
-			quality = 85 // default
-		}
-		err = jpeg.Encode(&buf, resizedImg, &jpeg.Options{Quality: quality})
-	case "png":
-		err = png.Encode(&buf, resizedImg)
-	case "gif":
-		err = gif.Encode(&buf, resizedImg, &gif.Options{NumColors: 256}) // fidelity
-	default:
-		return nil, fmt.Errorf(
-			"unsupported file format: %v. Supported formats are: jpeg, png, gif",
-			outputFormat,
-		)
-	}
 
+	buf, err := encodeWith(resizedImg, outputFormat, EncodeOptions{Quality: quality})
 	if err != nil {
-		return nil, fmt.Errorf("failed to encode image as %s: %v", outputFormat, err)
+		return nil, err
 	}
 
 	if buf.Len() == 0 {
 		return nil, fmt.Errorf("encoding produced empty buffer")
 	}
 
-	return &buf, nil
+	return buf, nil
 }
 
 // findBestWidthBinarySearch() - perform a binary search on width to find the largest width that yields <= maxSize
@@ -139,7 +472,7 @@ func findBestWidthBinarySearch(img image.Image, minWidth, maxWidth, maxSize int,
 
 		size := buf.Len()
 		if verbose {
-			fmt.Printf("[binary] Trying width: %d -> Compressed size: %.2f KB\n", mid, float64(size)/1024.0)
+			fmt.Fprintf(LogOutput, "[binary] Trying width: %d -> Compressed size: %.2f KB\n", mid, float64(size)/1024.0)
 		}
 
 		if size > maxSize {
@@ -154,12 +487,12 @@ func findBestWidthBinarySearch(img image.Image, minWidth, maxWidth, maxSize int,
 	return best, bestBuf, nil
 }
 
-// linearRefine() - perform a linear search downward from startWidth to minWidth in small steps to try to meet maxSize
+// linearRefine() - perform a linear search downward from startWidth to minWidth in small steps to try to meet maxSize, returns the width and buffer
 /* img (image.Image) - input image; startWidth (int) - starting width; minWidth (int) - minimum width; maxSize (int) - maximum size in bytes;
    outputFormat (string) - jpeg, png, or gif; quality (int) - JPEG quality; verbose (bool) - enable verbose logging */
-func linearRefine(img image.Image, startWidth, minWidth, maxSize int, outputFormat string, quality int, verbose bool) (*bytes.Buffer, error) {
+func linearRefine(img image.Image, startWidth, minWidth, maxSize int, outputFormat string, quality int, verbose bool) (int, *bytes.Buffer, error) {
 	if startWidth <= 0 {
-		return nil, fmt.Errorf("invalid start width")
+		return 0, nil, fmt.Errorf("invalid start width")
 	}
 
 	step := startWidth / 20
@@ -170,31 +503,24 @@ func linearRefine(img image.Image, startWidth, minWidth, maxSize int, outputForm
 	for w := startWidth; w >= minWidth; w -= step {
 		buf, err := encodeResizedToBuffer(img, w, outputFormat, quality)
 		if err != nil {
-			return nil, err
+			return 0, nil, err
 		}
 
 		size := buf.Len()
 		if verbose {
-			fmt.Printf("[linear] Trying width: %d -> Compressed size: %.2f KB\n", w, float64(size)/1024.0)
+			fmt.Fprintf(LogOutput, "[linear] Trying width: %d -> Compressed size: %.2f KB\n", w, float64(size)/1024.0)
 		}
 
 		if size <= maxSize {
-			return buf, nil
+			return w, buf, nil
 		}
 	}
 
-	return nil, fmt.Errorf("no linear refinement found")
+	return 0, nil, fmt.Errorf("no linear refinement found")
 }
 
-// saveBufferToFile() - write the content of buf to a file at outputPath
+// saveBufferToFile() - atomically write the content of buf to a file at outputPath
 /* outputPath (string) - path of the output image; buf (*bytes.Buffer) - buffer containing image data */
 func saveBufferToFile(outputPath string, buf *bytes.Buffer) error {
-	outFile, err := os.Create(outputPath)
-	if err != nil {
-		return err
-	}
-	defer outFile.Close()
-
-	_, err = buf.WriteTo(outFile)
-	return err
+	return WriteFileAtomic(outputPath, buf.Bytes())
 }
@@ -2,6 +2,7 @@ package compressor
 
 import (
 	"bytes"
+	"errors"
 	"image"
 	"image/color"
 	"image/jpeg"
@@ -87,7 +88,7 @@ func TestFindBestWidthBinarySearchAndLinearRefine(t *testing.T) {
 	}
 
 	// linearRefine() starting at best should succeed (since size already <= maxSize)
-	refined, err := linearRefine(img, best, minWidth, maxSize, "jpeg", 80, false)
+	refinedWidth, refined, err := linearRefine(img, best, minWidth, maxSize, "jpeg", 80, false)
 	if err != nil {
 		t.Fatalf("linearRefine returned error: %v", err)
 	}
@@ -95,6 +96,10 @@ func TestFindBestWidthBinarySearchAndLinearRefine(t *testing.T) {
 	if refined == nil || refined.Len() == 0 {
 		t.Fatalf("linearRefine returned empty buffer")
 	}
+
+	if refinedWidth != best {
+		t.Fatalf("expected refined width %d, got %d", best, refinedWidth)
+	}
 }
 
 // TestLinearRefine_InvalidStartWidth() - test error handling for invalid start width
@@ -102,7 +107,7 @@ func TestFindBestWidthBinarySearchAndLinearRefine(t *testing.T) {
 func TestLinearRefine_InvalidStartWidth(t *testing.T) {
 	img := makeTestImage(200, 200)
 
-	if _, err := linearRefine(img, 0, 10, 1000, "jpeg", 80, false); err == nil {
+	if _, _, err := linearRefine(img, 0, 10, 1000, "jpeg", 80, false); err == nil {
 		t.Fatalf("expected error for invalid start width")
 	}
 }
@@ -178,3 +183,133 @@ func TestCompressImage_EndToEnd(t *testing.T) {
 		t.Fatalf("output file is empty")
 	}
 }
+
+// TestCompress_SquareCrop() - test that Compress() applies the crop step and reports the result
+/* t (*testing.T) - testing object */
+func TestCompress_SquareCrop(t *testing.T) {
+	td := t.TempDir()
+	inPath := filepath.Join(td, "in.png")
+	outPath := filepath.Join(td, "out.png")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, makeTestImage(300, 200)); err != nil {
+		t.Fatalf("png encode: %v", err)
+	}
+
+	if err := os.WriteFile(inPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("write in file: %v", err)
+	}
+
+	result, err := Compress(inPath, outPath, Options{
+		MaxSize:      5 * 1024 * 1024,
+		OutputFormat: "png",
+		Quality:      85,
+		Crop:         CropSpec{Mode: CropCenter},
+	})
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	if result.Width != result.Height {
+		t.Errorf("expected square output, got %dx%d", result.Width, result.Height)
+	}
+
+	if result.CropRect != image.Rect(50, 0, 250, 200) {
+		t.Errorf("unexpected crop rect %v", result.CropRect)
+	}
+
+	// lossless output of a flat image should be a near-perfect match
+	if result.SSIM < 0.99 || result.PSNR < 40 {
+		t.Errorf("expected near-perfect quality metrics, got SSIM %v PSNR %v", result.SSIM, result.PSNR)
+	}
+}
+
+// TestCompress_MinSSIM() - test that the quality floor mode meets its SSIM target and beats maximum quality on size
+/* t (*testing.T) - testing object */
+func TestCompress_MinSSIM(t *testing.T) {
+	td := t.TempDir()
+	inPath := filepath.Join(td, "in.png")
+	outPath := filepath.Join(td, "out.jpg")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, makeSubjectImage(240, 240, 40, 40, 160)); err != nil {
+		t.Fatalf("png encode: %v", err)
+	}
+
+	if err := os.WriteFile(inPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("write in file: %v", err)
+	}
+
+	result, err := Compress(inPath, outPath, Options{
+		OutputFormat: "jpeg",
+		Quality:      85,
+		MinSSIM:      0.9,
+	})
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	if result.SSIM < 0.9 {
+		t.Errorf("expected SSIM >= 0.9, got %v", result.SSIM)
+	}
+
+	full, err := encodeResizedToBuffer(makeSubjectImage(240, 240, 40, 40, 160), 240, "jpeg", 100)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	if result.Size >= full.Len() {
+		t.Errorf("expected output (%d bytes) smaller than quality 100 at full width (%d bytes)", result.Size, full.Len())
+	}
+
+	// an unreachable floor under a tiny cap fails
+	if _, err := Compress(inPath, outPath, Options{OutputFormat: "jpeg", MaxSize: 200, MinSSIM: 0.999}); err == nil {
+		t.Errorf("expected error for unreachable SSIM floor")
+	}
+}
+
+// TestCompress_DryRun() - test that dry runs report a plan without writing output
+/* t (*testing.T) - testing object */
+func TestCompress_DryRun(t *testing.T) {
+	td := t.TempDir()
+	inPath := filepath.Join(td, "in.png")
+	outPath := filepath.Join(td, "out.jpg")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, makeNoiseImage(300, 300, 2)); err != nil {
+		t.Fatalf("png encode: %v", err)
+	}
+
+	if err := os.WriteFile(inPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("write in file: %v", err)
+	}
+
+	result, err := Compress(inPath, outPath, Options{MaxSize: 20 * 1024, OutputFormat: "jpeg", Quality: 85, DryRun: true})
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	if !result.Reachable || result.Size > 20*1024 || result.Width == 0 {
+		t.Errorf("unexpected plan: %+v", result)
+	}
+
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Errorf("dry run must not write the output file")
+	}
+
+	// unreachable targets are reported, not returned as errors
+	result, err = Compress(inPath, outPath, Options{MaxSize: 100, OutputFormat: "jpeg", Quality: 85, DryRun: true})
+	if err != nil {
+		t.Fatalf("expected no error for unreachable dry run, got %v", err)
+	}
+
+	if result.Reachable || result.Size <= 100 || len(result.Warnings) == 0 {
+		t.Errorf("expected unreachable plan with a warning, got %+v", result)
+	}
+
+	// without dry run the same target is an error
+	var unreachable *UnreachableError
+	if _, err := Compress(inPath, outPath, Options{MaxSize: 100, OutputFormat: "jpeg", Quality: 85}); !errors.As(err, &unreachable) {
+		t.Errorf("expected UnreachableError, got %v", err)
+	}
+}
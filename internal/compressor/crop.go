@@ -0,0 +1,397 @@
+package compressor
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// crop modes accepted by CropSpec.Mode
+const (
+	CropNone   = ""
+	CropCenter = "center"
+	CropSmart  = "smart"
+	CropManual = "manual"
+	CropPad    = "pad"
+)
+
+// smartCropSampleSize is the longest side used when scoring smart crop candidates
+const smartCropSampleSize = 256
+
+// FocusPoint is a point of interest expressed as fractions of the image width and height
+/* X (float64) - horizontal position in [0, 1]; Y (float64) - vertical position in [0, 1] */
+type FocusPoint struct {
+	X float64
+	Y float64
+}
+
+// CropSpec describes how an image is reduced before compression
+/* Mode (string) - none, center, smart, manual, or pad (letterbox to a square instead of cropping)
+   Rect (image.Rectangle) - region to keep for manual crops, in source pixels
+   Focus (*FocusPoint) - optional point the square crop is centered on, overriding center and smart placement
+   Pad (PadBackground) - canvas fill for pad mode */
+type CropSpec struct {
+	Mode  string
+	Rect  image.Rectangle
+	Focus *FocusPoint
+	Pad   PadBackground
+}
+
+// CropInfo describes what a crop step did
+/* Rect (image.Rectangle) - region of the source that was kept */
+type CropInfo struct {
+	Rect image.Rectangle
+}
+
+// ParseCrop() - parse a crop argument of the form center, smart, or x,y,w,h into a CropSpec
+/* spec (string) - crop argument as given on the command line or in a form field */
+func ParseCrop(spec string) (CropSpec, error) {
+	spec = strings.TrimSpace(strings.ToLower(spec))
+
+	switch spec {
+	case "", "none":
+		return CropSpec{Mode: CropNone}, nil
+	case CropCenter, CropSmart:
+		return CropSpec{Mode: spec}, nil
+	}
+
+	parts := strings.Split(spec, ",")
+	if len(parts) != 4 {
+		return CropSpec{}, fmt.Errorf("invalid crop %q: expected center, smart, or x,y,w,h", spec)
+	}
+
+	vals := make([]int, 4)
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return CropSpec{}, fmt.Errorf("invalid crop %q: %q is not an integer", spec, p)
+		}
+		vals[i] = n
+	}
+
+	if vals[0] < 0 || vals[1] < 0 || vals[2] <= 0 || vals[3] <= 0 {
+		return CropSpec{}, fmt.Errorf("invalid crop %q: offsets must be >= 0 and sizes > 0", spec)
+	}
+
+	return CropSpec{
+		Mode: CropManual,
+		Rect: image.Rect(vals[0], vals[1], vals[0]+vals[2], vals[1]+vals[3]),
+	}, nil
+}
+
+// ParseFocus() - parse a focus argument of the form x,y where both values are fractions in [0, 1]
+/* spec (string) - focus argument as given on the command line or in a form field */
+func ParseFocus(spec string) (*FocusPoint, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(spec, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid focus %q: expected x,y", spec)
+	}
+
+	x, errX := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	y, errY := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if errX != nil || errY != nil {
+		return nil, fmt.Errorf("invalid focus %q: values must be numbers", spec)
+	}
+
+	if x < 0 || x > 1 || y < 0 || y > 1 {
+		return nil, fmt.Errorf("invalid focus %q: values must be between 0 and 1", spec)
+	}
+
+	return &FocusPoint{X: x, Y: y}, nil
+}
+
+// ApplyCrop() - crop img according to spec, returns the cropped image and the region of img that was kept
+/* img (image.Image) - source image; spec (CropSpec) - crop settings */
+func ApplyCrop(img image.Image, spec CropSpec) (image.Image, image.Rectangle, error) {
+	cropped, info, err := applyCrop(img, spec)
+	return cropped, info.Rect, err
+}
+
+// CropRect() - compute the region of img selected by spec without cropping
+/* img (image.Image) - source image; spec (CropSpec) - crop settings */
+func CropRect(img image.Image, spec CropSpec) (image.Rectangle, error) {
+	info, err := cropInfo(img, spec)
+	return info.Rect, err
+}
+
+// applyCrop() - crop img according to spec, returns the cropped image and details about the crop
+/* img (image.Image) - source image; spec (CropSpec) - crop settings */
+func applyCrop(img image.Image, spec CropSpec) (image.Image, CropInfo, error) {
+	bounds := img.Bounds()
+
+	// a focus point without a mode implies a square crop around it
+	if spec.Mode == CropNone && spec.Focus == nil {
+		return img, CropInfo{Rect: bounds}, nil
+	}
+
+	// padding keeps the whole source
+	if spec.Mode == CropPad {
+		return padToSquare(img, spec.Pad), CropInfo{Rect: bounds}, nil
+	}
+
+	info, err := cropInfo(img, spec)
+	if err != nil {
+		return nil, CropInfo{}, err
+	}
+
+	if info.Rect == bounds {
+		return img, info, nil
+	}
+
+	return imaging.Crop(img, info.Rect), info, nil
+}
+
+// cropInfo() - compute the region of img selected by spec
+/* img (image.Image) - source image; spec (CropSpec) - crop settings */
+func cropInfo(img image.Image, spec CropSpec) (CropInfo, error) {
+	bounds := img.Bounds()
+
+	if spec.Mode == CropPad {
+		return CropInfo{Rect: bounds}, nil
+	}
+
+	if spec.Mode == CropManual {
+		rect := spec.Rect.Add(bounds.Min)
+		if !rect.In(bounds) {
+			return CropInfo{}, fmt.Errorf("crop region %v is outside the %dx%d image",
+				spec.Rect, bounds.Dx(), bounds.Dy())
+		}
+
+		return CropInfo{Rect: rect}, nil
+	}
+
+	switch {
+	case spec.Focus != nil:
+		return CropInfo{Rect: focusSquare(bounds, *spec.Focus)}, nil
+	case spec.Mode == CropCenter:
+		return CropInfo{Rect: centerSquare(bounds)}, nil
+	case spec.Mode == CropSmart:
+		return CropInfo{Rect: smartSquare(img)}, nil
+	}
+
+	return CropInfo{}, fmt.Errorf("unknown crop mode: %s", spec.Mode)
+}
+
+// centerSquare() - return the largest square centered in bounds
+/* bounds (image.Rectangle) - image bounds */
+func centerSquare(bounds image.Rectangle) image.Rectangle {
+	return focusSquare(bounds, FocusPoint{X: 0.5, Y: 0.5})
+}
+
+// focusSquare() - return the largest square in bounds centered as close as possible to focus
+/* bounds (image.Rectangle) - image bounds; focus (FocusPoint) - relative point to center on */
+func focusSquare(bounds image.Rectangle, focus FocusPoint) image.Rectangle {
+	size := bounds.Dx()
+	if bounds.Dy() < size {
+		size = bounds.Dy()
+	}
+
+	cx := bounds.Min.X + int(focus.X*float64(bounds.Dx()))
+	cy := bounds.Min.Y + int(focus.Y*float64(bounds.Dy()))
+
+	return squareAround(bounds, cx, cy, size)
+}
+
+// squareAround() - return a size x size square centered on (cx, cy) and shifted to stay within bounds
+/* bounds (image.Rectangle) - image bounds; cx, cy (int) - desired center; size (int) - side length */
+func squareAround(bounds image.Rectangle, cx, cy, size int) image.Rectangle {
+	x0 := clamp(cx-size/2, bounds.Min.X, bounds.Max.X-size)
+	y0 := clamp(cy-size/2, bounds.Min.Y, bounds.Max.Y-size)
+
+	return image.Rect(x0, y0, x0+size, y0+size)
+}
+
+// smartSquare() - pick the square region of img with the most detail, preferring the center on ties
+/* img (image.Image) - source image */
+func smartSquare(img image.Image) image.Rectangle {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == h {
+		return bounds
+	}
+
+	// score a downscaled copy for speed, then map the winner back to source pixels
+	scale := 1.0
+	if w > smartCropSampleSize || h > smartCropSampleSize {
+		scale = float64(smartCropSampleSize) / float64(max(w, h))
+	}
+
+	sw := max(1, int(float64(w)*scale))
+	sh := max(1, int(float64(h)*scale))
+	sample := imaging.Resize(img, sw, sh, imaging.Box)
+	energy := newIntegral(detailEnergy(sample), sw, sh)
+
+	side := min(sw, sh)
+	span := max(sw, sh) - side
+	step := max(1, span/32)
+
+	type candidate struct {
+		offset  int
+		edges   float64
+		entropy float64
+	}
+
+	var candidates []candidate
+	maxEdges := 0.0
+	for off := 0; off <= span; off += step {
+		r := image.Rect(off, 0, off+side, side)
+		if sh > sw {
+			r = image.Rect(0, off, side, off+side)
+		}
+
+		c := candidate{
+			offset:  off,
+			edges:   energy.sum(r),
+			entropy: lumaEntropy(sample, r),
+		}
+		maxEdges = math.Max(maxEdges, c.edges)
+		candidates = append(candidates, c)
+	}
+
+	bestOffset, bestScore := span/2, math.Inf(-1)
+	for _, c := range candidates {
+		edges := 0.0
+		if maxEdges > 0 {
+			edges = c.edges / maxEdges
+		}
+
+		centerBias := 1.0
+		if span > 0 {
+			centerBias = 1 - math.Abs(float64(c.offset)-float64(span)/2)/(float64(span)/2)
+		}
+
+		score := 0.6*edges + 0.3*c.entropy + 0.1*centerBias
+		if score > bestScore {
+			bestScore, bestOffset = score, c.offset
+		}
+	}
+
+	// map back to source coordinates
+	size := min(w, h)
+	offset := clamp(int(float64(bestOffset)/scale+0.5), 0, max(w, h)-size)
+	if h > w {
+		return image.Rect(bounds.Min.X, bounds.Min.Y+offset, bounds.Min.X+size, bounds.Min.Y+offset+size)
+	}
+
+	return image.Rect(bounds.Min.X+offset, bounds.Min.Y, bounds.Min.X+offset+size, bounds.Min.Y+size)
+}
+
+// detailEnergy() - compute a per-pixel saliency score from Sobel edge magnitude and color saturation
+/* img (*image.NRGBA) - image to score */
+func detailEnergy(img *image.NRGBA) []float64 {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	luma := make([]float64, w*h)
+	sat := make([]float64, w*h)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := img.PixOffset(x, y)
+			r, g, b := float64(img.Pix[i]), float64(img.Pix[i+1]), float64(img.Pix[i+2])
+			luma[y*w+x] = 0.299*r + 0.587*g + 0.114*b
+
+			hi, lo := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+			if hi > 0 {
+				sat[y*w+x] = (hi - lo) / hi
+			}
+		}
+	}
+
+	at := func(x, y int) float64 {
+		return luma[clamp(y, 0, h-1)*w+clamp(x, 0, w-1)]
+	}
+
+	energy := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			energy[y*w+x] = math.Hypot(gx, gy)/1020 + 0.25*sat[y*w+x]
+		}
+	}
+
+	return energy
+}
+
+// lumaEntropy() - compute the normalized Shannon entropy of the luma histogram inside r
+/* img (*image.NRGBA) - image to measure; r (image.Rectangle) - region to measure */
+func lumaEntropy(img *image.NRGBA, r image.Rectangle) float64 {
+	const bins = 32
+	var hist [bins]int
+	total := 0
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			l := (299*int(img.Pix[i]) + 587*int(img.Pix[i+1]) + 114*int(img.Pix[i+2])) / 1000
+			hist[l*bins/256]++
+			total++
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	entropy := 0.0
+	for _, n := range hist {
+		if n == 0 {
+			continue
+		}
+		p := float64(n) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy / math.Log2(bins)
+}
+
+// integral is a summed-area table for fast rectangle sums
+type integral struct {
+	w    int
+	sums []float64
+}
+
+// newIntegral() - build a summed-area table from per-pixel values
+/* vals ([]float64) - row-major values; w (int) - width; h (int) - height */
+func newIntegral(vals []float64, w, h int) *integral {
+	sums := make([]float64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		row := 0.0
+		for x := 0; x < w; x++ {
+			row += vals[y*w+x]
+			sums[(y+1)*(w+1)+x+1] = sums[y*(w+1)+x+1] + row
+		}
+	}
+
+	return &integral{w: w, sums: sums}
+}
+
+// sum() - return the sum of values inside r
+/* r (image.Rectangle) - region to sum */
+func (in *integral) sum(r image.Rectangle) float64 {
+	stride := in.w + 1
+	return in.sums[r.Max.Y*stride+r.Max.X] - in.sums[r.Min.Y*stride+r.Max.X] -
+		in.sums[r.Max.Y*stride+r.Min.X] + in.sums[r.Min.Y*stride+r.Min.X]
+}
+
+// clamp() - limit v to the range [lo, hi]
+/* v (int) - value; lo (int) - lower bound; hi (int) - upper bound */
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+
+	if v > hi {
+		return hi
+	}
+
+	return v
+}
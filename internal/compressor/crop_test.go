@@ -0,0 +1,159 @@
+package compressor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// makeSubjectImage() - create a flat image with a detailed checkerboard subject at the given offset
+/* w (int) - width of the image; h (int) - height of the image
+   sx, sy (int) - top-left corner of the subject; size (int) - side length of the subject */
+func makeSubjectImage(w, h, sx, sy, size int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	bg := color.RGBA{R: 220, G: 220, B: 220, A: 255}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, bg)
+		}
+	}
+
+	for y := sy; y < sy+size; y++ {
+		for x := sx; x < sx+size; x++ {
+			if (x/4+y/4)%2 == 0 {
+				img.Set(x, y, color.RGBA{R: 200, G: 20, B: 20, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{R: 10, G: 10, B: 10, A: 255})
+			}
+		}
+	}
+
+	return img
+}
+
+// TestParseCrop() - test parsing of crop arguments
+/* t (*testing.T) - testing object */
+func TestParseCrop(t *testing.T) {
+	tests := []struct {
+		in      string
+		mode    string
+		rect    image.Rectangle
+		wantErr bool
+	}{
+		{"", CropNone, image.Rectangle{}, false},
+		{"center", CropCenter, image.Rectangle{}, false},
+		{"SMART", CropSmart, image.Rectangle{}, false},
+		{"10,20,30,40", CropManual, image.Rect(10, 20, 40, 60), false},
+		{"10,20,30", "", image.Rectangle{}, true},
+		{"10,20,0,40", "", image.Rectangle{}, true},
+		{"a,b,c,d", "", image.Rectangle{}, true},
+		{"face", "", image.Rectangle{}, true},
+	}
+
+	for _, tt := range tests {
+		spec, err := ParseCrop(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseCrop(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+
+		if err == nil && (spec.Mode != tt.mode || spec.Rect != tt.rect) {
+			t.Errorf("ParseCrop(%q) = %+v, want mode %q rect %v", tt.in, spec, tt.mode, tt.rect)
+		}
+	}
+}
+
+// TestParseFocus() - test parsing of focus arguments
+/* t (*testing.T) - testing object */
+func TestParseFocus(t *testing.T) {
+	if f, err := ParseFocus(""); err != nil || f != nil {
+		t.Fatalf("expected nil focus for empty string, got %v, %v", f, err)
+	}
+
+	f, err := ParseFocus("0.25, 0.75")
+	if err != nil {
+		t.Fatalf("ParseFocus failed: %v", err)
+	}
+
+	if f.X != 0.25 || f.Y != 0.75 {
+		t.Errorf("expected 0.25,0.75, got %v,%v", f.X, f.Y)
+	}
+
+	for _, bad := range []string{"1.5,0.5", "0.5", "x,y"} {
+		if _, err := ParseFocus(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+// TestCropRect_Modes() - test the region chosen by each crop mode
+/* t (*testing.T) - testing object */
+func TestCropRect_Modes(t *testing.T) {
+	img := makeSubjectImage(300, 100, 220, 20, 60)
+
+	tests := []struct {
+		name string
+		spec CropSpec
+		want image.Rectangle
+	}{
+		{"Center", CropSpec{Mode: CropCenter}, image.Rect(100, 0, 200, 100)},
+		{"Smart", CropSpec{Mode: CropSmart}, image.Rect(200, 0, 300, 100)},
+		{"Focus", CropSpec{Mode: CropCenter, Focus: &FocusPoint{X: 0, Y: 0.5}}, image.Rect(0, 0, 100, 100)},
+		{"Manual", CropSpec{Mode: CropManual, Rect: image.Rect(10, 10, 60, 60)}, image.Rect(10, 10, 60, 60)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CropRect(img, tt.spec)
+			if err != nil {
+				t.Fatalf("CropRect failed: %v", err)
+			}
+
+			if tt.name == "Smart" {
+				// the subject must be fully inside the chosen square
+				if !image.Rect(220, 20, 280, 80).In(got) || got.Dx() != 100 || got.Dy() != 100 {
+					t.Errorf("smart crop %v does not contain the subject", got)
+				}
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestCropRect_SmartFlatImageUsesCenter() - test that smart crop falls back to the center on featureless images
+/* t (*testing.T) - testing object */
+func TestCropRect_SmartFlatImageUsesCenter(t *testing.T) {
+	img := makeTestImage(100, 400)
+
+	got, err := CropRect(img, CropSpec{Mode: CropSmart})
+	if err != nil {
+		t.Fatalf("CropRect failed: %v", err)
+	}
+
+	if want := image.Rect(0, 150, 100, 250); got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+// TestApplyCrop_ManualOutOfBounds() - test error handling for manual regions outside the image
+/* t (*testing.T) - testing object */
+func TestApplyCrop_ManualOutOfBounds(t *testing.T) {
+	img := makeTestImage(100, 100)
+
+	if _, _, err := ApplyCrop(img, CropSpec{Mode: CropManual, Rect: image.Rect(50, 50, 150, 150)}); err == nil {
+		t.Fatalf("expected error for out-of-bounds crop")
+	}
+
+	cropped, rect, err := ApplyCrop(img, CropSpec{Mode: CropManual, Rect: image.Rect(10, 20, 40, 50)})
+	if err != nil {
+		t.Fatalf("ApplyCrop failed: %v", err)
+	}
+
+	if cropped.Bounds().Dx() != 30 || cropped.Bounds().Dy() != 30 || rect != image.Rect(10, 20, 40, 50) {
+		t.Errorf("unexpected crop result: bounds %v, rect %v", cropped.Bounds(), rect)
+	}
+}
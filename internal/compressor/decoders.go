@@ -0,0 +1,53 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"io"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// tiffDecoder reads baseline TIFF exports, little- and big-endian
+type tiffDecoder struct{}
+
+func (tiffDecoder) Name() string         { return "tiff" }
+func (tiffDecoder) Extensions() []string { return []string{".tif", ".tiff"} }
+func (tiffDecoder) Match(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("II*\x00")) || bytes.HasPrefix(header, []byte("MM\x00*"))
+}
+func (tiffDecoder) Decode(r io.Reader) (image.Image, error) { return tiff.Decode(r) }
+
+// bmpDecoder reads Windows bitmaps
+type bmpDecoder struct{}
+
+func (bmpDecoder) Name() string                            { return "bmp" }
+func (bmpDecoder) Extensions() []string                    { return []string{".bmp"} }
+func (bmpDecoder) Match(header []byte) bool                { return bytes.HasPrefix(header, []byte("BM")) }
+func (bmpDecoder) Decode(r io.Reader) (image.Image, error) { return bmp.Decode(r) }
+
+// fallbackOutputs maps input-only formats to the output format they compress to by default
+var fallbackOutputs = map[string]string{
+	"tiff": "jpeg",
+	"bmp":  "jpeg",
+	"ico":  "png", // icons and logos are usually transparent
+	"svg":  "png",
+}
+
+// DefaultOutputFormat() - pick the output format for an input format, the same format when it can be written
+/* inputFormat (string) - decoder name reported by DecodeImage() or DetectFormat() */
+func DefaultOutputFormat(inputFormat string) (string, bool) {
+	if enc, ok := LookupEncoder(inputFormat); ok {
+		return enc.Name(), true
+	}
+
+	format, ok := fallbackOutputs[inputFormat]
+	return format, ok
+}
+
+// init() - register the extra input formats
+func init() {
+	RegisterDecoder(tiffDecoder{})
+	RegisterDecoder(bmpDecoder{})
+}
@@ -0,0 +1,78 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// TestDecodeImage_TIFFAndBMP() - test that TIFF and BMP data is recognized by content and decoded
+/* t (*testing.T) - testing object */
+func TestDecodeImage_TIFFAndBMP(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 12, 8))
+	img.Set(3, 4, color.RGBA{0, 128, 255, 255})
+
+	var tiffBuf, bmpBuf bytes.Buffer
+	if err := tiff.Encode(&tiffBuf, img, nil); err != nil {
+		t.Fatalf("tiff encode: %v", err)
+	}
+
+	if err := bmp.Encode(&bmpBuf, img); err != nil {
+		t.Fatalf("bmp encode: %v", err)
+	}
+
+	for name, buf := range map[string]*bytes.Buffer{"tiff": &tiffBuf, "bmp": &bmpBuf} {
+		decoded, format, err := DecodeImage(buf)
+		if err != nil {
+			t.Fatalf("DecodeImage(%s) failed: %v", name, err)
+		}
+
+		if format != name || decoded.Bounds().Dx() != 12 || decoded.Bounds().Dy() != 8 {
+			t.Errorf("expected 12x8 %s, got %s %v", name, format, decoded.Bounds())
+		}
+
+		r, g, b, _ := decoded.At(3, 4).RGBA()
+		if r>>8 != 0 || g>>8 != 128 || b>>8 != 255 {
+			t.Errorf("%s: unexpected pixel %d,%d,%d", name, r>>8, g>>8, b>>8)
+		}
+	}
+}
+
+// TestDetectFormat() - test sniffing ignores misleading extensions and maps input-only formats to an output
+/* t (*testing.T) - testing object */
+func TestDetectFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := bmp.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("bmp encode: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "export.jpg")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	format, err := DetectFormat(path)
+	if err != nil || format != "bmp" {
+		t.Fatalf("expected bmp, got %q (%v)", format, err)
+	}
+
+	if out, ok := DefaultOutputFormat(format); !ok || out != "jpeg" {
+		t.Errorf("expected bmp to compress to jpeg, got %q", out)
+	}
+
+	if out, ok := DefaultOutputFormat("png"); !ok || out != "png" {
+		t.Errorf("expected png to stay png, got %q", out)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.png")
+	os.WriteFile(empty, nil, 0644)
+	if _, err := DetectFormat(empty); err == nil {
+		t.Error("expected error for empty file")
+	}
+}
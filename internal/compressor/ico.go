@@ -0,0 +1,390 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	"github.com/disintegration/imaging"
+)
+
+// icoHeaderLen and icoEntryLen are the sizes of the ICONDIR header and each ICONDIRENTRY
+const (
+	icoHeaderLen = 6
+	icoEntryLen  = 16
+)
+
+// IconSizes are the standard icon sizes packed into .ico output
+var IconSizes = []int{16, 32, 48, 64, 128, 256}
+
+// icoPNGMinSize is the smallest entry stored PNG-compressed; smaller ones use 32-bit bitmaps,
+// which every icon reader understands
+const icoPNGMinSize = 64
+
+// maxIconSide is the largest icon entry, the directory stores sides up to 256 in a single byte
+const maxIconSide = 256
+
+// pngSignature starts every PNG-compressed icon entry
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// icoEntry is one image in an .ico directory
+/* Width, Height (int) - size in pixels, 0 in the file means 256; BitCount (int) - bits per pixel
+   Size (int) - length of the image data; Offset (int) - where the image data starts */
+type icoEntry struct {
+	Width, Height int
+	BitCount      int
+	Size, Offset  int
+}
+
+// icoCodec reads Windows icons and cursors, keeping the largest image, and writes multi-resolution icons
+type icoCodec struct{}
+
+// icoDecoder is icoCodec on the input side, where cursors are read as well; the encoder writes icons only,
+// since a .cur would also need a hotspot
+type icoDecoder struct{ icoCodec }
+
+func (icoCodec) Name() string            { return "ico" }
+func (icoCodec) Extensions() []string    { return []string{".ico"} }
+func (icoDecoder) Extensions() []string  { return []string{".ico", ".cur"} }
+func (icoCodec) MIMEType() string        { return "image/x-icon" }
+func (icoCodec) SupportsAlpha() bool     { return true }
+func (icoCodec) SupportsAnimation() bool { return false }
+func (icoCodec) Knobs() []Knob           { return nil }
+
+// WidthLimits() - icons top out at 256 pixels and go down to 16
+// (icoCodec) - ICO codec
+func (icoCodec) WidthLimits() (int, int) { return IconSizes[0], IconSizes[len(IconSizes)-1] }
+
+// Encode() - write every standard size below img's width plus img's width itself into one icon
+// (icoCodec) - ICO codec
+func (icoCodec) Encode(w io.Writer, img image.Image, _ EncodeOptions) error {
+	largest := min(img.Bounds().Dx(), IconSizes[len(IconSizes)-1])
+	if largest < 1 {
+		return errors.New("ico: empty image")
+	}
+
+	var sizes []int
+	for _, size := range IconSizes {
+		if size < largest {
+			sizes = append(sizes, size)
+		}
+	}
+	sizes = append(sizes, largest)
+
+	payloads := make([][]byte, len(sizes))
+	for i, size := range sizes {
+		entry := iconSquare(img, size)
+
+		var err error
+		if size >= icoPNGMinSize {
+			var buf bytes.Buffer
+			err = png.Encode(&buf, entry)
+			payloads[i] = buf.Bytes()
+		} else {
+			payloads[i] = encodeDIB(entry)
+		}
+
+		if err != nil {
+			return fmt.Errorf("ico: failed to encode %dx%d entry: %v", size, size, err)
+		}
+	}
+
+	return writeICO(w, sizes, payloads)
+}
+
+// Match() - check for the ICONDIR header: reserved 0, type 1 (icon) or 2 (cursor), at least one image
+// (icoCodec) - ICO decoder
+func (icoCodec) Match(header []byte) bool {
+	if len(header) < icoHeaderLen {
+		return false
+	}
+
+	kind := binary.LittleEndian.Uint16(header[2:])
+	count := binary.LittleEndian.Uint16(header[4:])
+	return header[0] == 0 && header[1] == 0 && (kind == 1 || kind == 2) && count > 0
+}
+
+// Decode() - decode the largest image in the icon
+// (icoCodec) - ICO decoder
+func (icoCodec) Decode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := parseICODirectory(data)
+	if err != nil {
+		return nil, err
+	}
+
+	best := entries[0]
+	for _, e := range entries[1:] {
+		if e.Width*e.Height > best.Width*best.Height || (e.Width*e.Height == best.Width*best.Height && e.BitCount > best.BitCount) {
+			best = e
+		}
+	}
+
+	if best.Offset+best.Size > len(data) {
+		return nil, errors.New("ico: image data out of range")
+	}
+
+	payload := data[best.Offset : best.Offset+best.Size]
+	if bytes.HasPrefix(payload, pngSignature) {
+		// the PNG header is checked first so a forged size cannot make png.Decode allocate a huge canvas
+		cfg, err := png.DecodeConfig(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg.Width > maxIconSide || cfg.Height > maxIconSide {
+			return nil, fmt.Errorf("ico: PNG entry %dx%d is larger than %dx%d", cfg.Width, cfg.Height, maxIconSide, maxIconSide)
+		}
+
+		return png.Decode(bytes.NewReader(payload))
+	}
+
+	return decodeDIB(payload, best)
+}
+
+// parseICODirectory() - read the ICONDIR header and entries
+/* data ([]byte) - full .ico file */
+func parseICODirectory(data []byte) ([]icoEntry, error) {
+	if len(data) < icoHeaderLen {
+		return nil, errors.New("ico: file too short")
+	}
+
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	if count == 0 || len(data) < icoHeaderLen+count*icoEntryLen {
+		return nil, errors.New("ico: truncated directory")
+	}
+
+	entries := make([]icoEntry, count)
+	for i := range entries {
+		b := data[icoHeaderLen+i*icoEntryLen:]
+		e := icoEntry{
+			Width:    int(b[0]),
+			Height:   int(b[1]),
+			BitCount: int(binary.LittleEndian.Uint16(b[6:])),
+			Size:     int(binary.LittleEndian.Uint32(b[8:])),
+			Offset:   int(binary.LittleEndian.Uint32(b[12:])),
+		}
+
+		if e.Width == 0 {
+			e.Width = 256
+		}
+
+		if e.Height == 0 {
+			e.Height = 256
+		}
+
+		entries[i] = e
+	}
+
+	return entries, nil
+}
+
+// decodeDIB() - decode a headerless bitmap as stored in icons: a BITMAPINFOHEADER, optional palette, color rows, then an AND mask
+/* data ([]byte) - bitmap bytes starting at the info header; entry (icoEntry) - directory entry the bitmap belongs to */
+func decodeDIB(data []byte, entry icoEntry) (image.Image, error) {
+	if len(data) < 40 {
+		return nil, errors.New("ico: bitmap header too short")
+	}
+
+	headerLen := int(binary.LittleEndian.Uint32(data[0:]))
+	width := int(int32(binary.LittleEndian.Uint32(data[4:])))
+	// the stored height covers both the color rows and the mask
+	height := int(int32(binary.LittleEndian.Uint32(data[8:]))) / 2
+	bitCount := int(binary.LittleEndian.Uint16(data[14:]))
+	compression := binary.LittleEndian.Uint32(data[16:])
+	colorsUsed := int(binary.LittleEndian.Uint32(data[32:]))
+
+	switch bitCount {
+	case 1, 4, 8, 24, 32:
+	default:
+		return nil, fmt.Errorf("ico: unsupported bit depth %d", bitCount)
+	}
+
+	if width <= 0 || height <= 0 || width > maxIconSide || height > maxIconSide || headerLen < 40 || headerLen > len(data) {
+		return nil, fmt.Errorf("ico: invalid bitmap size %dx%d", width, height)
+	}
+
+	if width != entry.Width || height != entry.Height {
+		return nil, fmt.Errorf("ico: bitmap size %dx%d does not match the directory entry %dx%d", width, height, entry.Width, entry.Height)
+	}
+
+	if compression != 0 {
+		return nil, fmt.Errorf("ico: compressed bitmaps are not supported")
+	}
+
+	var palette []color.NRGBA
+	if bitCount <= 8 {
+		n := colorsUsed
+		if n == 0 {
+			n = 1 << bitCount
+		}
+
+		if n > 1<<bitCount || headerLen+n*4 > len(data) {
+			return nil, errors.New("ico: truncated palette")
+		}
+
+		palette = make([]color.NRGBA, n)
+		for i := range palette {
+			p := data[headerLen+i*4:]
+			palette[i] = color.NRGBA{R: p[2], G: p[1], B: p[0], A: 255}
+		}
+	}
+
+	// width and height are capped above, so these products cannot overflow
+	pixels := data[headerLen+len(palette)*4:]
+	stride := (width*bitCount + 31) / 32 * 4
+	maskStride := (width + 31) / 32 * 4
+	if len(pixels) < stride*height {
+		return nil, errors.New("ico: truncated bitmap")
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	hasAlpha := false
+
+	// rows are stored bottom-up
+	for y := 0; y < height; y++ {
+		row := pixels[(height-1-y)*stride:]
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+			switch bitCount {
+			case 32:
+				c = color.NRGBA{R: row[x*4+2], G: row[x*4+1], B: row[x*4], A: row[x*4+3]}
+				hasAlpha = hasAlpha || c.A != 0
+			case 24:
+				c = color.NRGBA{R: row[x*3+2], G: row[x*3+1], B: row[x*3], A: 255}
+			default:
+				bit := x * bitCount
+				idx := int(row[bit/8]>>(8-bitCount-bit%8)) & (1<<bitCount - 1)
+				if idx < len(palette) {
+					c = palette[idx]
+				}
+			}
+
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	// 32-bit icons with an empty alpha channel are opaque apart from the mask
+	if bitCount == 32 && !hasAlpha {
+		for i := 3; i < len(img.Pix); i += 4 {
+			img.Pix[i] = 255
+		}
+	}
+
+	// icons without an alpha channel use the 1-bit AND mask for transparency
+	mask := pixels[stride*height:]
+	if !hasAlpha && len(mask) >= maskStride*height {
+		for y := 0; y < height; y++ {
+			row := mask[(height-1-y)*maskStride:]
+			for x := 0; x < width; x++ {
+				if row[x/8]>>(7-x%8)&1 == 1 {
+					img.Pix[img.PixOffset(x, y)+3] = 0
+				}
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// iconSquare() - scale img to fit a size x size square, centered on a transparent canvas
+/* img (image.Image) - source image; size (int) - side of the icon entry */
+func iconSquare(img image.Image, size int) *image.NRGBA {
+	fitted := imaging.Fit(img, size, size, imaging.Lanczos)
+	if fitted.Bounds().Dx() == size && fitted.Bounds().Dy() == size {
+		return fitted
+	}
+
+	canvas := imaging.New(size, size, color.NRGBA{})
+	offset := image.Pt((size-fitted.Bounds().Dx())/2, (size-fitted.Bounds().Dy())/2)
+	return imaging.Overlay(canvas, fitted, offset, 1.0)
+}
+
+// encodeDIB() - encode an icon entry as a 32-bit bottom-up bitmap with an AND mask derived from alpha
+/* img (*image.NRGBA) - square icon entry */
+func encodeDIB(img *image.NRGBA) []byte {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	maskStride := (w + 31) / 32 * 4
+
+	var buf bytes.Buffer
+	buf.Grow(40 + w*h*4 + maskStride*h)
+
+	// BITMAPINFOHEADER, with the height doubled to cover the mask
+	header := make([]byte, 40)
+	binary.LittleEndian.PutUint32(header[0:], 40)
+	binary.LittleEndian.PutUint32(header[4:], uint32(w))
+	binary.LittleEndian.PutUint32(header[8:], uint32(h*2))
+	binary.LittleEndian.PutUint16(header[12:], 1)
+	binary.LittleEndian.PutUint16(header[14:], 32)
+	binary.LittleEndian.PutUint32(header[20:], uint32(w*h*4+maskStride*h))
+	buf.Write(header)
+
+	for y := h - 1; y >= 0; y-- {
+		for x := 0; x < w; x++ {
+			c := img.NRGBAAt(x, y)
+			buf.Write([]byte{c.B, c.G, c.R, c.A})
+		}
+	}
+
+	// fully transparent pixels are masked out for readers that ignore alpha
+	for y := h - 1; y >= 0; y-- {
+		row := make([]byte, maskStride)
+		for x := 0; x < w; x++ {
+			if img.NRGBAAt(x, y).A == 0 {
+				row[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		buf.Write(row)
+	}
+
+	return buf.Bytes()
+}
+
+// writeICO() - write the ICONDIR header, one entry per payload, then the payloads
+/* w (io.Writer) - destination; sizes ([]int) - side of each entry; payloads ([][]byte) - encoded entries */
+func writeICO(w io.Writer, sizes []int, payloads [][]byte) error {
+	var buf bytes.Buffer
+
+	header := make([]byte, icoHeaderLen)
+	binary.LittleEndian.PutUint16(header[2:], 1)
+	binary.LittleEndian.PutUint16(header[4:], uint16(len(payloads)))
+	buf.Write(header)
+
+	offset := icoHeaderLen + icoEntryLen*len(payloads)
+	for i, p := range payloads {
+		entry := make([]byte, icoEntryLen)
+
+		// 256 is stored as 0
+		entry[0] = byte(sizes[i] % 256)
+		entry[1] = byte(sizes[i] % 256)
+		binary.LittleEndian.PutUint16(entry[4:], 1)
+		binary.LittleEndian.PutUint16(entry[6:], 32)
+		binary.LittleEndian.PutUint32(entry[8:], uint32(len(p)))
+		binary.LittleEndian.PutUint32(entry[12:], uint32(offset))
+		buf.Write(entry)
+
+		offset += len(p)
+	}
+
+	for _, p := range payloads {
+		buf.Write(p)
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// init() - register icons as both an input and an output format
+func init() {
+	RegisterEncoder(icoCodec{}, "favicon")
+	RegisterDecoder(icoDecoder{})
+}
@@ -0,0 +1,276 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildICO() - assemble an .ico file from raw entry payloads
+/* sizes ([]int) - side length of each entry; bitCounts ([]int) - bits per pixel of each entry; payloads ([][]byte) - entry data */
+func buildICO(sizes, bitCounts []int, payloads [][]byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, [3]uint16{0, 1, uint16(len(payloads))})
+
+	offset := icoHeaderLen + icoEntryLen*len(payloads)
+	for i, p := range payloads {
+		side := byte(sizes[i])
+		if sizes[i] >= 256 {
+			side = 0
+		}
+
+		buf.Write([]byte{side, side, 0, 0})
+		binary.Write(&buf, binary.LittleEndian, uint16(1))
+		binary.Write(&buf, binary.LittleEndian, uint16(bitCounts[i]))
+		binary.Write(&buf, binary.LittleEndian, uint32(len(p)))
+		binary.Write(&buf, binary.LittleEndian, uint32(offset))
+		offset += len(p)
+	}
+
+	for _, p := range payloads {
+		buf.Write(p)
+	}
+
+	return buf.Bytes()
+}
+
+// buildDIB24() - build a 24-bit icon bitmap of a solid color whose top-left pixel is masked out
+/* size (int) - side length; c (color.RGBA) - fill color */
+func buildDIB24(size int, c color.RGBA) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(40))
+	binary.Write(&buf, binary.LittleEndian, int32(size))
+	binary.Write(&buf, binary.LittleEndian, int32(size*2))
+	binary.Write(&buf, binary.LittleEndian, uint16(1))
+	binary.Write(&buf, binary.LittleEndian, uint16(24))
+	buf.Write(make([]byte, 24))
+
+	stride := (size*24 + 31) / 32 * 4
+	for y := 0; y < size; y++ {
+		row := make([]byte, stride)
+		for x := 0; x < size; x++ {
+			row[x*3], row[x*3+1], row[x*3+2] = c.B, c.G, c.R
+		}
+		buf.Write(row)
+	}
+
+	// mask rows are bottom-up too, so the last row written is the top of the image
+	maskStride := (size + 31) / 32 * 4
+	for y := 0; y < size; y++ {
+		row := make([]byte, maskStride)
+		if y == size-1 {
+			row[0] = 0x80
+		}
+		buf.Write(row)
+	}
+
+	return buf.Bytes()
+}
+
+// TestICODecoder() - test that the largest entry is decoded from both PNG and bitmap icons
+/* t (*testing.T) - testing object */
+func TestICODecoder(t *testing.T) {
+	small := buildDIB24(16, color.RGBA{255, 0, 0, 255})
+
+	large := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for i := range large.Pix {
+		large.Pix[i] = 200
+	}
+	var pngBuf bytes.Buffer
+	png.Encode(&pngBuf, large)
+
+	data := buildICO([]int{16, 32}, []int{24, 32}, [][]byte{small, pngBuf.Bytes()})
+
+	img, format, err := DecodeImage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeImage failed: %v", err)
+	}
+
+	if format != "ico" || img.Bounds().Dx() != 32 {
+		t.Errorf("expected 32px ico entry, got %s %v", format, img.Bounds())
+	}
+
+	// the bitmap entry on its own
+	data = buildICO([]int{16}, []int{24}, [][]byte{small})
+	img, _, err = DecodeImage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeImage bitmap failed: %v", err)
+	}
+
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("expected masked top-left pixel to be transparent, alpha %d", a)
+	}
+
+	if r, g, _, a := img.At(5, 5).RGBA(); r>>8 != 255 || g != 0 || a>>8 != 255 {
+		t.Errorf("expected opaque red, got r=%d g=%d a=%d", r>>8, g>>8, a>>8)
+	}
+
+	// cursors share the layout with type 2 in the header and are read like icons
+	binary.LittleEndian.PutUint16(data[2:], 2)
+	if _, format, err := DecodeImage(bytes.NewReader(data)); err != nil || format != "ico" {
+		t.Errorf("expected the cursor to decode as ico, got %s (%v)", format, err)
+	}
+}
+
+// TestICODecoder_Truncated() - test that damaged icons are rejected
+/* t (*testing.T) - testing object */
+func TestICODecoder_Truncated(t *testing.T) {
+	data := buildICO([]int{16}, []int{24}, [][]byte{buildDIB24(16, color.RGBA{A: 255})})
+	if _, err := (icoCodec{}).Decode(bytes.NewReader(data[:len(data)/2])); err == nil {
+		t.Error("expected error for truncated icon")
+	}
+
+	// a complete directory whose bitmap stops halfway through the pixel rows
+	dib := buildDIB24(16, color.RGBA{A: 255})
+	data = buildICO([]int{16}, []int{24}, [][]byte{dib[:len(dib)/2]})
+	if _, err := (icoCodec{}).Decode(bytes.NewReader(data)); err == nil {
+		t.Error("expected error for truncated bitmap")
+	}
+}
+
+// TestICODecoder_Oversized() - test that forged bitmap headers are rejected instead of crashing or exhausting memory
+/* t (*testing.T) - testing object */
+func TestICODecoder_Oversized(t *testing.T) {
+	tests := []struct {
+		name                    string
+		width, height, bitCount int
+	}{
+		{"overflowing size and no bit depth", 0x7fffffff, 0x7ffffffe, 0},
+		{"huge size", 40000, 80000, 32},
+		{"larger than an icon", 512, 1024, 32},
+		{"different from the directory", 32, 64, 24},
+		{"unknown bit depth", 16, 32, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dib := buildDIB24(16, color.RGBA{A: 255})
+			binary.LittleEndian.PutUint32(dib[4:], uint32(tt.width))
+			binary.LittleEndian.PutUint32(dib[8:], uint32(tt.height))
+			binary.LittleEndian.PutUint16(dib[14:], uint16(tt.bitCount))
+
+			data := buildICO([]int{16}, []int{24}, [][]byte{dib})
+			if _, _, err := DecodeImage(bytes.NewReader(data)); err == nil {
+				t.Error("expected error for forged bitmap header")
+			}
+		})
+	}
+
+	// a PNG entry claiming a canvas far beyond an icon
+	var pngBuf bytes.Buffer
+	png.Encode(&pngBuf, image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	forged := pngBuf.Bytes()
+	binary.BigEndian.PutUint32(forged[16:], 60000)
+	binary.BigEndian.PutUint32(forged[20:], 60000)
+	binary.BigEndian.PutUint32(forged[29:], crc32.ChecksumIEEE(forged[12:29]))
+
+	data := buildICO([]int{256}, []int{32}, [][]byte{forged})
+	if _, _, err := DecodeImage(bytes.NewReader(data)); err == nil {
+		t.Error("expected error for oversized PNG entry")
+	}
+}
+
+// TestICOEncoder() - test that icons pack the standard sizes and round-trip through the decoder
+/* t (*testing.T) - testing object */
+func TestICOEncoder(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 300, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 300; x++ {
+			// transparent left third
+			if x >= 100 {
+				src.SetNRGBA(x, y, color.NRGBA{R: 30, G: 90, B: 200, A: 255})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := (icoCodec{}).Encode(&buf, src, EncodeOptions{}); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	data := buf.Bytes()
+	entries, err := parseICODirectory(data)
+	if err != nil {
+		t.Fatalf("parseICODirectory failed: %v", err)
+	}
+
+	if len(entries) != len(IconSizes) {
+		t.Fatalf("expected %d entries, got %d", len(IconSizes), len(entries))
+	}
+
+	for i, e := range entries {
+		if e.Width != IconSizes[i] || e.Height != IconSizes[i] {
+			t.Errorf("entry %d: expected %d, got %dx%d", i, IconSizes[i], e.Width, e.Height)
+		}
+
+		isPNG := bytes.HasPrefix(data[e.Offset:], pngSignature)
+		if isPNG != (e.Width >= icoPNGMinSize) {
+			t.Errorf("entry %d: unexpected PNG compression %v for size %d", i, isPNG, e.Width)
+		}
+	}
+
+	// icons are written without a hotspot, so .cur is not an output extension
+	if enc, ok := EncoderForExtension(".ico"); !ok || enc.Name() != "ico" {
+		t.Error("expected .ico to select the ico encoder")
+	}
+	if _, ok := EncoderForExtension(".cur"); ok {
+		t.Error("expected no encoder for .cur")
+	}
+
+	decoded, format, err := DecodeImage(bytes.NewReader(data))
+	if err != nil || format != "ico" || decoded.Bounds().Dx() != 256 {
+		t.Fatalf("expected 256px icon back, got %s %v (%v)", format, decoded.Bounds(), err)
+	}
+
+	// the 16px bitmap entry keeps its transparency
+	small, err := decodeDIB(data[entries[0].Offset:entries[0].Offset+entries[0].Size], entries[0])
+	if err != nil {
+		t.Fatalf("decodeDIB failed: %v", err)
+	}
+
+	if _, _, _, a := small.At(0, 8).RGBA(); a != 0 {
+		t.Errorf("expected transparent pixel in the 16px entry, alpha %d", a>>8)
+	}
+
+	if _, _, b, a := small.At(15, 8).RGBA(); b>>8 < 150 || a>>8 != 255 {
+		t.Errorf("expected opaque blue in the 16px entry, b=%d a=%d", b>>8, a>>8)
+	}
+}
+
+// TestCompress_ICOBudget() - test that the size search drops icon sizes to fit the byte budget
+/* t (*testing.T) - testing object */
+func TestCompress_ICOBudget(t *testing.T) {
+	td := t.TempDir()
+	inPath := filepath.Join(td, "logo.png")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, makeNoiseImage(400, 400, 5)); err != nil {
+		t.Fatalf("png encode: %v", err)
+	}
+	os.WriteFile(inPath, buf.Bytes(), 0644)
+
+	full, err := Compress(inPath, filepath.Join(td, "full.ico"), Options{MaxSize: 10 * 1024 * 1024, OutputFormat: "ico"})
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	if full.Width != 256 {
+		t.Errorf("expected a 256px icon with a large budget, got %d", full.Width)
+	}
+
+	budget := full.Size / 2
+	small, err := Compress(inPath, filepath.Join(td, "small.ico"), Options{MaxSize: budget, OutputFormat: "favicon"})
+	if err != nil {
+		t.Fatalf("Compress with budget failed: %v", err)
+	}
+
+	if small.Size > budget || small.Width >= 256 || small.Format != "ico" {
+		t.Errorf("expected a smaller icon within %d bytes, got %+v", budget, small)
+	}
+}
@@ -0,0 +1,125 @@
+package compressor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+)
+
+// ImageInfo describes an image file as gitfit decodes it
+/* Format (string) - decoder name; Width, Height (int) - dimensions in pixels
+   Size (int64) - file size in bytes; ColorModel (string) - human-readable color model
+   HasAlpha (bool) - whether any pixel is not fully opaque; Frames (int) - frames of an animated GIF or PNG, 1 for still images
+   Orientation (int) - EXIF orientation 1-8, 0 when absent; HasGPS (bool) - EXIF carries a GPS position
+   ICC (*ICCProfile) - embedded color profile, nil when absent */
+type ImageInfo struct {
+	Format      string
+	Width       int
+	Height      int
+	Size        int64
+	ColorModel  string
+	HasAlpha    bool
+	Frames      int
+	Orientation int
+	HasGPS      bool
+	ICC         *ICCProfile
+}
+
+// InspectFile() - decode an image file and describe it, including its frame count, EXIF and ICC details
+/* path (string) - image file in any supported input format */
+func InspectFile(path string) (*ImageInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	img, format, err := DecodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrDecode, path, err)
+	}
+
+	info := &ImageInfo{
+		Format:     format,
+		Width:      img.Bounds().Dx(),
+		Height:     img.Bounds().Dy(),
+		Size:       int64(len(data)),
+		ColorModel: colorModelName(img.ColorModel()),
+		HasAlpha:   !isOpaque(img),
+	}
+	readMetadata(data, format, info)
+
+	return info, nil
+}
+
+// OrientationName() - describe an EXIF orientation value
+/* o (int) - orientation 1-8, 0 when absent */
+func OrientationName(o int) string {
+	switch o {
+	case 1:
+		return "normal"
+	case 2:
+		return "mirrored horizontally"
+	case 3:
+		return "rotated 180°"
+	case 4:
+		return "mirrored vertically"
+	case 5:
+		return "mirrored and rotated 90° counterclockwise"
+	case 6:
+		return "rotated 90° clockwise"
+	case 7:
+		return "mirrored and rotated 90° clockwise"
+	case 8:
+		return "rotated 90° counterclockwise"
+	}
+
+	return "none"
+}
+
+// colorModelName() - name the standard color models, other models are reported as other
+/* m (color.Model) - color model of a decoded image */
+func colorModelName(m color.Model) string {
+	switch m {
+	case color.RGBAModel, color.NRGBAModel:
+		return "RGBA"
+	case color.RGBA64Model, color.NRGBA64Model:
+		return "RGBA, 16-bit"
+	case color.GrayModel:
+		return "grayscale"
+	case color.Gray16Model:
+		return "grayscale, 16-bit"
+	case color.YCbCrModel:
+		return "YCbCr"
+	case color.CMYKModel:
+		return "CMYK"
+	case color.AlphaModel, color.Alpha16Model:
+		return "alpha only"
+	}
+
+	if _, ok := m.(color.Palette); ok {
+		return "paletted"
+	}
+
+	return "other"
+}
+
+// isOpaque() - report whether every pixel of img is fully opaque
+/* img (image.Image) - decoded image */
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,43 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestInspectFile() - test the reported format, dimensions, size and alpha of a file
+/* t (*testing.T) - testing object */
+func TestInspectFile(t *testing.T) {
+	dir := t.TempDir()
+
+	var buf bytes.Buffer
+	png.Encode(&buf, makeTestImage(40, 30))
+	opaquePath := filepath.Join(dir, "opaque.png")
+	os.WriteFile(opaquePath, buf.Bytes(), 0644)
+
+	info, err := InspectFile(opaquePath)
+	if err != nil {
+		t.Fatalf("InspectFile failed: %v", err)
+	}
+
+	if info.Format != "png" || info.Width != 40 || info.Height != 30 || info.Size != int64(buf.Len()) || info.HasAlpha {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	buf.Reset()
+	png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 8, 8)))
+	clearPath := filepath.Join(dir, "clear.png")
+	os.WriteFile(clearPath, buf.Bytes(), 0644)
+
+	if info, err := InspectFile(clearPath); err != nil || !info.HasAlpha {
+		t.Errorf("expected a transparent image to report alpha, got %+v (%v)", info, err)
+	}
+
+	if _, err := InspectFile(filepath.Join(dir, "missing.png")); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
@@ -0,0 +1,268 @@
+package compressor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image/gif"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxICCSize bounds the decompressed size of a PNG color profile
+const maxICCSize = 16 << 20
+
+// ICCProfile describes an embedded color profile
+/* Description (string) - profile name such as sRGB IEC61966-2.1; ColorSpace (string) - data color space such as RGB or CMYK
+   Size (int) - profile size in bytes */
+type ICCProfile struct {
+	Description string
+	ColorSpace  string
+	Size        int
+}
+
+// readMetadata() - fill in the frame count, EXIF and ICC details of info from the raw file
+/* data ([]byte) - file contents; format (string) - decoder name; info (*ImageInfo) - description to complete */
+func readMetadata(data []byte, format string, info *ImageInfo) {
+	info.Frames = 1
+
+	switch format {
+	case "jpeg":
+		readJPEGMetadata(data, info)
+	case "png":
+		readPNGMetadata(data, info)
+	case "tiff":
+		readTIFFMetadata(data, info)
+	case "gif":
+		if g, err := gif.DecodeAll(bytes.NewReader(data)); err == nil {
+			info.Frames = len(g.Image)
+		}
+	}
+}
+
+// readJPEGMetadata() - read the EXIF (APP1) and ICC (APP2) segments in front of the image data
+/* b ([]byte) - JPEG file; info (*ImageInfo) - description to complete */
+func readJPEGMetadata(b []byte, info *ImageInfo) {
+	var icc []byte
+
+	for i := 2; i+4 <= len(b) && b[i] == 0xFF; {
+		marker := b[i+1]
+		if marker == 0xFF {
+			i++ // fill byte
+			continue
+		}
+
+		// the metadata sits before the scan
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+
+		n := int(binary.BigEndian.Uint16(b[i+2:]))
+		if n < 2 || i+2+n > len(b) {
+			break
+		}
+		seg := b[i+4 : i+2+n]
+
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")):
+			readTIFFMetadata(seg[6:], info)
+		case marker == 0xE2 && bytes.HasPrefix(seg, []byte("ICC_PROFILE\x00")) && len(seg) > 14:
+			// large profiles are split over several segments, each with a sequence number and count
+			icc = append(icc, seg[14:]...)
+		}
+
+		i += 2 + n
+	}
+
+	if len(icc) > 0 {
+		info.ICC = parseICC(icc)
+	}
+}
+
+// readPNGMetadata() - read the eXIf, iCCP and acTL (animation) chunks
+/* b ([]byte) - PNG file; info (*ImageInfo) - description to complete */
+func readPNGMetadata(b []byte, info *ImageInfo) {
+	for i := 8; i+12 <= len(b); {
+		n := int(binary.BigEndian.Uint32(b[i:]))
+		if n < 0 || i+12+n > len(b) {
+			return
+		}
+		data := b[i+8 : i+8+n]
+
+		switch string(b[i+4 : i+8]) {
+		case "eXIf":
+			readTIFFMetadata(data, info)
+		case "acTL":
+			if n >= 4 {
+				info.Frames = int(binary.BigEndian.Uint32(data))
+			}
+		case "iCCP":
+			// profile name, a null byte, the compression method and the zlib stream
+			name, rest, ok := bytes.Cut(data, []byte{0})
+			if !ok || len(rest) < 2 {
+				break
+			}
+
+			r, err := zlib.NewReader(bytes.NewReader(rest[1:]))
+			if err != nil {
+				break
+			}
+			profile, err := io.ReadAll(io.LimitReader(r, maxICCSize))
+			if err != nil {
+				break
+			}
+
+			info.ICC = parseICC(profile)
+			if info.ICC.Description == "" {
+				info.ICC.Description = string(name)
+			}
+		case "IEND":
+			return
+		}
+
+		i += 12 + n
+	}
+}
+
+// readTIFFMetadata() - read the orientation, GPS and ICC tags of the first IFD of a TIFF structure
+// (the body of an EXIF block, or a TIFF file itself)
+/* b ([]byte) - TIFF structure; info (*ImageInfo) - description to complete */
+func readTIFFMetadata(b []byte, info *ImageInfo) {
+	if len(b) < 8 {
+		return
+	}
+
+	var bo binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return
+	}
+
+	if bo.Uint16(b[2:]) != 42 {
+		return
+	}
+
+	for _, e := range tiffEntries(b, bo, bo.Uint32(b[4:])) {
+		switch e.tag {
+		case 0x0112: // Orientation, a SHORT kept in the value field
+			if v := int(bo.Uint16(e.value)); e.typ == 3 && v >= 1 && v <= 8 {
+				info.Orientation = v
+			}
+		case 0x8825: // pointer to the GPS IFD, cameras write an empty one when there was no fix
+			for _, g := range tiffEntries(b, bo, bo.Uint32(e.value)) {
+				if g.tag == 0x0002 { // GPSLatitude
+					info.HasGPS = true
+				}
+			}
+		case 0x8773: // InterColorProfile, an UNDEFINED blob
+			start, size := int64(bo.Uint32(e.value)), int64(e.count)
+			if size > 4 && start+size <= int64(len(b)) {
+				info.ICC = parseICC(b[start : start+size])
+			}
+		}
+	}
+}
+
+// tiffEntry is one tag of a TIFF IFD
+/* tag (uint16) - tag number; typ (uint16) - field type; count (uint32) - number of values
+   value ([]byte) - the 4-byte value or offset field */
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// tiffEntries() - list the entries of the IFD at offset, none when it is out of bounds
+/* b ([]byte) - TIFF structure; bo (binary.ByteOrder) - its byte order; offset (uint32) - IFD position */
+func tiffEntries(b []byte, bo binary.ByteOrder, offset uint32) []tiffEntry {
+	off := int64(offset)
+	if off < 8 || off+2 > int64(len(b)) {
+		return nil
+	}
+
+	n := int64(bo.Uint16(b[off:]))
+	var entries []tiffEntry
+	for i := int64(0); i < n; i++ {
+		e := off + 2 + i*12
+		if e+12 > int64(len(b)) {
+			break
+		}
+
+		entries = append(entries, tiffEntry{
+			tag:   bo.Uint16(b[e:]),
+			typ:   bo.Uint16(b[e+2:]),
+			count: bo.Uint32(b[e+4:]),
+			value: b[e+8 : e+12],
+		})
+	}
+
+	return entries
+}
+
+// parseICC() - describe an ICC profile from its header and desc tag
+/* p ([]byte) - profile data */
+func parseICC(p []byte) *ICCProfile {
+	profile := &ICCProfile{Size: len(p)}
+	if len(p) < 132 {
+		return profile
+	}
+
+	profile.ColorSpace = strings.TrimSpace(string(p[16:20]))
+
+	count := int(binary.BigEndian.Uint32(p[128:]))
+	for i := 0; i < count && 132+i*12+12 <= len(p); i++ {
+		e := 132 + i*12
+		if string(p[e:e+4]) != "desc" {
+			continue
+		}
+
+		off, size := int64(binary.BigEndian.Uint32(p[e+4:])), int64(binary.BigEndian.Uint32(p[e+8:]))
+		if off+size <= int64(len(p)) {
+			profile.Description = iccText(p[off : off+size])
+		}
+		break
+	}
+
+	return profile
+}
+
+// iccText() - decode an ICC text tag, the ASCII desc type of version 2 or the mluc type of version 4
+/* t ([]byte) - tag data */
+func iccText(t []byte) string {
+	if len(t) < 16 {
+		return ""
+	}
+
+	switch string(t[:4]) {
+	case "desc":
+		n := int64(binary.BigEndian.Uint32(t[8:]))
+		if 12+n > int64(len(t)) {
+			return ""
+		}
+		return strings.TrimRight(string(t[12:12+n]), "\x00")
+	case "mluc":
+		// the first record is enough to name the profile
+		if binary.BigEndian.Uint32(t[8:]) == 0 || len(t) < 28 {
+			return ""
+		}
+
+		n, off := int64(binary.BigEndian.Uint32(t[20:])), int64(binary.BigEndian.Uint32(t[24:]))
+		if off+n > int64(len(t)) {
+			return ""
+		}
+
+		units := make([]uint16, n/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(t[off+int64(i)*2:])
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	}
+
+	return ""
+}
@@ -0,0 +1,134 @@
+package compressor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testExif() - build a little-endian EXIF body with orientation 6 and a GPS latitude
+func testExif() []byte {
+	le := binary.LittleEndian
+	b := []byte("II")
+	b = le.AppendUint16(b, 42)
+	b = le.AppendUint32(b, 8)
+
+	// IFD0 at 8: orientation and the GPS pointer, the GPS IFD follows at 8+2+2*12+4
+	b = le.AppendUint16(b, 2)
+	b = append(le.AppendUint16(le.AppendUint16(b, 0x0112), 3), 1, 0, 0, 0, 6, 0, 0, 0)
+	b = le.AppendUint32(le.AppendUint32(le.AppendUint16(le.AppendUint16(b, 0x8825), 4), 1), 38)
+	b = le.AppendUint32(b, 0)
+
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint32(le.AppendUint32(le.AppendUint16(le.AppendUint16(b, 0x0002), 5), 3), 0)
+	return le.AppendUint32(b, 0)
+}
+
+// testICC() - build a minimal version 2 RGB profile with a desc tag
+/* desc (string) - profile description */
+func testICC(desc string) []byte {
+	be := binary.BigEndian
+	p := make([]byte, 128)
+	copy(p[16:], "RGB ")
+
+	text := append([]byte("desc\x00\x00\x00\x00"), be.AppendUint32(nil, uint32(len(desc)+1))...)
+	text = append(append(text, desc...), 0)
+
+	p = be.AppendUint32(p, 1)
+	p = append(p, "desc"...)
+	p = be.AppendUint32(be.AppendUint32(p, 144), uint32(len(text)))
+	p = append(p, text...)
+	be.PutUint32(p, uint32(len(p)))
+	return p
+}
+
+// pngChunk() - encode a PNG chunk with its checksum
+/* typ (string) - chunk type; data ([]byte) - chunk data */
+func pngChunk(typ string, data []byte) []byte {
+	c := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	c = append(append(c, typ...), data...)
+	return binary.BigEndian.AppendUint32(c, crc32.ChecksumIEEE(c[4:]))
+}
+
+// TestInspectFile_Metadata() - test EXIF, ICC and frame details of JPEG, PNG and GIF files
+/* t (*testing.T) - testing object */
+func TestInspectFile_Metadata(t *testing.T) {
+	dir := t.TempDir()
+	icc := testICC("sRGB IEC61966-2.1")
+
+	// JPEG with APP1 EXIF and APP2 ICC segments after SOI
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, makeTestImage(40, 30), nil)
+	app1 := append([]byte("Exif\x00\x00"), testExif()...)
+	app2 := append([]byte("ICC_PROFILE\x00\x01\x01"), icc...)
+	var segs []byte
+	for _, seg := range []struct {
+		marker byte
+		data   []byte
+	}{{0xE1, app1}, {0xE2, app2}} {
+		segs = append(segs, 0xFF, seg.marker)
+		segs = binary.BigEndian.AppendUint16(segs, uint16(len(seg.data)+2))
+		segs = append(segs, seg.data...)
+	}
+	jpegPath := filepath.Join(dir, "photo.jpg")
+	os.WriteFile(jpegPath, append(append([]byte{0xFF, 0xD8}, segs...), buf.Bytes()[2:]...), 0644)
+
+	info, err := InspectFile(jpegPath)
+	if err != nil {
+		t.Fatalf("InspectFile failed: %v", err)
+	}
+	if info.Orientation != 6 || !info.HasGPS || info.Frames != 1 {
+		t.Errorf("expected orientation 6 with GPS, got %+v", info)
+	}
+	if info.ICC == nil || info.ICC.Description != "sRGB IEC61966-2.1" || info.ICC.ColorSpace != "RGB" || info.ICC.Size != len(icc) {
+		t.Errorf("unexpected ICC profile %+v", info.ICC)
+	}
+
+	// PNG with iCCP and eXIf chunks after IHDR
+	buf.Reset()
+	png.Encode(&buf, makeTestImage(20, 20))
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(icc)
+	zw.Close()
+	iccp := append([]byte("Display\x00\x00"), z.Bytes()...)
+	ihdrEnd := 8 + 12 + 13
+	data := append([]byte{}, buf.Bytes()[:ihdrEnd]...)
+	data = append(data, pngChunk("iCCP", iccp)...)
+	data = append(data, pngChunk("eXIf", testExif())...)
+	data = append(data, buf.Bytes()[ihdrEnd:]...)
+	pngPath := filepath.Join(dir, "photo.png")
+	os.WriteFile(pngPath, data, 0644)
+
+	info, err = InspectFile(pngPath)
+	if err != nil {
+		t.Fatalf("InspectFile failed: %v", err)
+	}
+	if info.Orientation != 6 || !info.HasGPS || info.ICC == nil || info.ICC.Description != "sRGB IEC61966-2.1" {
+		t.Errorf("unexpected PNG metadata %+v %+v", info, info.ICC)
+	}
+
+	// animated GIF
+	anim := &gif.GIF{}
+	for i := 0; i < 3; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 8, 8), palette.Plan9))
+		anim.Delay = append(anim.Delay, 10)
+	}
+	buf.Reset()
+	gif.EncodeAll(&buf, anim)
+	gifPath := filepath.Join(dir, "anim.gif")
+	os.WriteFile(gifPath, buf.Bytes(), 0644)
+
+	if info, err := InspectFile(gifPath); err != nil || info.Frames != 3 || info.Orientation != 0 || info.ICC != nil {
+		t.Errorf("expected 3 frames without metadata, got %+v (%v)", info, err)
+	}
+}
@@ -0,0 +1,182 @@
+package compressor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// MaxPSNR is reported instead of infinity when two images are identical
+const MaxPSNR = 100.0
+
+// metricsSampleSize is the longest side images are reduced to before comparing them
+const metricsSampleSize = 512
+
+// ssimWindow and ssimStride control the sliding window used for SSIM
+const (
+	ssimWindow = 8
+	ssimStride = 4
+)
+
+// SSIM() - compute the structural similarity of two images on luma, 1 means identical
+/* ref (image.Image) - reference image, resized to match out; out (image.Image) - image to score */
+func SSIM(ref, out image.Image) float64 {
+	a, b := commonSize(ref, out)
+	return ssim(a, b)
+}
+
+// PSNR() - compute the peak signal-to-noise ratio of two images in dB, capped at MaxPSNR
+/* ref (image.Image) - reference image, resized to match out; out (image.Image) - image to score */
+func PSNR(ref, out image.Image) float64 {
+	a, b := commonSize(ref, out)
+	return psnr(a, b)
+}
+
+// measureQuality() - decode an encoded output and compare it against the source at the output size, returns SSIM and PSNR
+/* ref (image.Image) - source image; buf (*bytes.Buffer) - encoded output */
+func measureQuality(ref image.Image, buf *bytes.Buffer) (float64, float64, error) {
+	out, _, err := DecodeImage(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to decode output for quality metrics: %v", err)
+	}
+
+	a, b := commonSize(ref, out)
+	return ssim(a, b), psnr(a, b), nil
+}
+
+// measureQualityAtSource() - decode an encoded output, scale it back up to the source size and compare, returns SSIM and PSNR
+/* ref (image.Image) - source image; buf (*bytes.Buffer) - encoded output
+
+   Unlike measureQuality(), this penalizes lost resolution, which is what a quality floor needs. */
+func measureQualityAtSource(ref image.Image, buf *bytes.Buffer) (float64, float64, error) {
+	out, _, err := DecodeImage(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to decode output for quality metrics: %v", err)
+	}
+
+	w, h := sampleSize(ref.Bounds().Dx(), ref.Bounds().Dy())
+	a := flattenOnWhite(imaging.Resize(ref, w, h, imaging.Lanczos))
+	b := flattenOnWhite(imaging.Resize(out, w, h, imaging.Lanczos))
+	return ssim(a, b), psnr(a, b), nil
+}
+
+// commonSize() - bring both images to the output's size (or smaller) and flatten them onto white
+/* ref (image.Image) - reference image; out (image.Image) - image to score */
+func commonSize(ref, out image.Image) (*image.NRGBA, *image.NRGBA) {
+	w, h := sampleSize(out.Bounds().Dx(), out.Bounds().Dy())
+
+	a := flattenOnWhite(imaging.Resize(ref, w, h, imaging.Lanczos))
+	b := flattenOnWhite(imaging.Resize(out, w, h, imaging.Lanczos))
+	return a, b
+}
+
+// sampleSize() - limit w x h to metricsSampleSize on the longest side, keeping the aspect ratio
+/* w (int) - width; h (int) - height */
+func sampleSize(w, h int) (int, int) {
+	if w > metricsSampleSize || h > metricsSampleSize {
+		scale := float64(metricsSampleSize) / float64(max(w, h))
+		w = max(1, int(float64(w)*scale))
+		h = max(1, int(float64(h)*scale))
+	}
+
+	return w, h
+}
+
+// flattenOnWhite() - composite an image over an opaque white background in place
+/* img (*image.NRGBA) - image to flatten */
+func flattenOnWhite(img *image.NRGBA) *image.NRGBA {
+	for i := 0; i < len(img.Pix); i += 4 {
+		a := float64(img.Pix[i+3]) / 255
+		for c := 0; c < 3; c++ {
+			img.Pix[i+c] = uint8(float64(img.Pix[i+c])*a + 255*(1-a) + 0.5)
+		}
+		img.Pix[i+3] = 255
+	}
+
+	return img
+}
+
+// ssim() - compute mean SSIM over sliding windows of two same-sized images
+/* a, b (*image.NRGBA) - images to compare */
+func ssim(a, b *image.NRGBA) float64 {
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+
+	w, h := a.Bounds().Dx(), a.Bounds().Dy()
+	la, lb := lumaPlane(a), lumaPlane(b)
+
+	win := min(ssimWindow, w, h)
+	total, n := 0.0, 0
+	for y := 0; y+win <= h; y += ssimStride {
+		for x := 0; x+win <= w; x += ssimStride {
+			var sa, sb, saa, sbb, sab float64
+			for wy := y; wy < y+win; wy++ {
+				for wx := x; wx < x+win; wx++ {
+					va, vb := la[wy*w+wx], lb[wy*w+wx]
+					sa += va
+					sb += vb
+					saa += va * va
+					sbb += vb * vb
+					sab += va * vb
+				}
+			}
+
+			count := float64(win * win)
+			ma, mb := sa/count, sb/count
+			varA := saa/count - ma*ma
+			varB := sbb/count - mb*mb
+			cov := sab/count - ma*mb
+
+			total += ((2*ma*mb + c1) * (2*cov + c2)) / ((ma*ma + mb*mb + c1) * (varA + varB + c2))
+			n++
+		}
+	}
+
+	if n == 0 {
+		return 1
+	}
+
+	return total / float64(n)
+}
+
+// psnr() - compute PSNR over the RGB channels of two same-sized images
+/* a, b (*image.NRGBA) - images to compare */
+func psnr(a, b *image.NRGBA) float64 {
+	var sum float64
+	n := 0
+	for i := 0; i < len(a.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			d := float64(a.Pix[i+c]) - float64(b.Pix[i+c])
+			sum += d * d
+			n++
+		}
+	}
+
+	if n == 0 || sum == 0 {
+		return MaxPSNR
+	}
+
+	mse := sum / float64(n)
+	return math.Min(MaxPSNR, 10*math.Log10(255*255/mse))
+}
+
+// lumaPlane() - extract the luma of each pixel as a row-major slice
+/* img (*image.NRGBA) - image to convert */
+func lumaPlane(img *image.NRGBA) []float64 {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	plane := make([]float64, w*h)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := img.PixOffset(x, y)
+			plane[y*w+x] = 0.299*float64(img.Pix[i]) + 0.587*float64(img.Pix[i+1]) + 0.114*float64(img.Pix[i+2])
+		}
+	}
+
+	return plane
+}
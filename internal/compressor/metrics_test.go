@@ -0,0 +1,82 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"testing"
+)
+
+// makeNoiseImage() - create an image of random colors so lossy encoding visibly degrades it
+/* w (int) - width of the image; h (int) - height of the image; seed (int64) - random seed */
+func makeNoiseImage(w, h int, seed int64) image.Image {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(rng.Intn(256)), G: uint8(rng.Intn(256)), B: uint8(rng.Intn(256)), A: 255})
+		}
+	}
+
+	return img
+}
+
+// TestSSIMAndPSNR_Identical() - test that identical images score perfectly
+/* t (*testing.T) - testing object */
+func TestSSIMAndPSNR_Identical(t *testing.T) {
+	img := makeSubjectImage(120, 120, 20, 20, 60)
+
+	if s := SSIM(img, img); s < 0.999 {
+		t.Errorf("expected SSIM ~1 for identical images, got %v", s)
+	}
+
+	if p := PSNR(img, img); p != MaxPSNR {
+		t.Errorf("expected PSNR %v for identical images, got %v", MaxPSNR, p)
+	}
+}
+
+// TestMeasureQuality_LossyIsWorse() - test that lower JPEG quality yields lower SSIM and PSNR
+/* t (*testing.T) - testing object */
+func TestMeasureQuality_LossyIsWorse(t *testing.T) {
+	img := makeNoiseImage(96, 96, 1)
+
+	encode := func(q int) *bytes.Buffer {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: q}); err != nil {
+			t.Fatalf("jpeg encode: %v", err)
+		}
+		return &buf
+	}
+
+	hiSSIM, hiPSNR, err := measureQuality(img, encode(95))
+	if err != nil {
+		t.Fatalf("measureQuality failed: %v", err)
+	}
+
+	loSSIM, loPSNR, err := measureQuality(img, encode(10))
+	if err != nil {
+		t.Fatalf("measureQuality failed: %v", err)
+	}
+
+	if !(loSSIM < hiSSIM && loPSNR < hiPSNR) {
+		t.Errorf("expected q10 (%.3f, %.1f dB) to score below q95 (%.3f, %.1f dB)", loSSIM, loPSNR, hiSSIM, hiPSNR)
+	}
+
+	if _, _, err := measureQuality(img, bytes.NewBufferString("not an image")); err == nil {
+		t.Errorf("expected error for undecodable output")
+	}
+}
+
+// TestSSIM_DifferentSizes() - test that the reference is resized to the output before comparing
+/* t (*testing.T) - testing object */
+func TestSSIM_DifferentSizes(t *testing.T) {
+	big := makeTestImage(400, 200)
+	small := makeTestImage(100, 50)
+
+	if s := SSIM(big, small); s < 0.99 {
+		t.Errorf("expected resized flat images to match, got SSIM %v", s)
+	}
+}
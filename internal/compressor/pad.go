@@ -0,0 +1,94 @@
+package compressor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// PadBackground describes how the empty area around a padded image is filled
+/* Color (color.NRGBA) - solid fill color; Blur (bool) - fill with a blurred, scaled copy of the image instead */
+type PadBackground struct {
+	Color color.NRGBA
+	Blur  bool
+}
+
+// named pad colors accepted by ParsePadBackground()
+var padColors = map[string]color.NRGBA{
+	"white":       {R: 255, G: 255, B: 255, A: 255},
+	"black":       {A: 255},
+	"transparent": {},
+}
+
+// ParsePadBackground() - parse a pad argument: blur, a color name, or a hex color (#rgb, #rrggbb, #rrggbbaa)
+/* spec (string) - pad argument as given on the command line or in a form field */
+func ParsePadBackground(spec string) (PadBackground, error) {
+	spec = strings.TrimSpace(strings.ToLower(spec))
+
+	if spec == "blur" {
+		return PadBackground{Blur: true}, nil
+	}
+
+	if c, ok := padColors[spec]; ok {
+		return PadBackground{Color: c}, nil
+	}
+
+	hex := strings.TrimPrefix(spec, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return PadBackground{}, fmt.Errorf("invalid pad background %q: expected blur, white, black, transparent, or a hex color", spec)
+	}
+
+	return PadBackground{Color: color.NRGBA{R: uint8(n >> 24), G: uint8(n >> 16), B: uint8(n >> 8), A: uint8(n)}}, nil
+}
+
+// CheckPadAlpha() - refuse a see-through pad color for output formats that cannot store it,
+// which would otherwise flatten the letterbox to black
+/* spec (CropSpec) - crop settings; formats (...string) - output formats the padded image is encoded in */
+func CheckPadAlpha(spec CropSpec, formats ...string) error {
+	if spec.Mode != CropPad || spec.Pad.Blur || spec.Pad.Color.A == 255 {
+		return nil
+	}
+
+	for _, format := range formats {
+		if enc, ok := LookupEncoder(format); ok && !enc.SupportsAlpha() {
+			return fmt.Errorf("%s has no alpha channel for a transparent pad background; pad with a solid color or blur, or pick a format such as png", enc.Name())
+		}
+	}
+
+	return nil
+}
+
+// padToSquare() - letterbox img onto a square canvas so no content is lost
+/* img (image.Image) - source image; bg (PadBackground) - how to fill the canvas */
+func padToSquare(img image.Image, bg PadBackground) image.Image {
+	bounds := img.Bounds()
+	size := max(bounds.Dx(), bounds.Dy())
+	if bounds.Dx() == bounds.Dy() {
+		return img
+	}
+
+	var canvas *image.NRGBA
+	if bg.Blur {
+		// scale a copy to cover the square and blur it so the letterbox blends in
+		canvas = imaging.Fill(img, size, size, imaging.Center, imaging.Linear)
+		canvas = imaging.Blur(canvas, float64(size)/30)
+	} else {
+		canvas = imaging.New(size, size, bg.Color)
+	}
+
+	offset := image.Pt((size-bounds.Dx())/2, (size-bounds.Dy())/2)
+	return imaging.Overlay(canvas, img, offset, 1.0)
+}
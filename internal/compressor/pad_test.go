@@ -0,0 +1,134 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestParsePadBackground() - test parsing of pad background arguments
+/* t (*testing.T) - testing object */
+func TestParsePadBackground(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    PadBackground
+		wantErr bool
+	}{
+		{"blur", PadBackground{Blur: true}, false},
+		{"white", PadBackground{Color: color.NRGBA{R: 255, G: 255, B: 255, A: 255}}, false},
+		{"#f00", PadBackground{Color: color.NRGBA{R: 255, A: 255}}, false},
+		{"00ff0080", PadBackground{Color: color.NRGBA{G: 255, A: 128}}, false},
+		{"#12345", PadBackground{}, true},
+		{"purple-ish", PadBackground{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePadBackground(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParsePadBackground(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+
+		if err == nil && got != tt.want {
+			t.Errorf("ParsePadBackground(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestPadToSquare() - test that padding keeps the source and fills the letterbox
+/* t (*testing.T) - testing object */
+func TestPadToSquare(t *testing.T) {
+	img := makeTestImage(200, 100)
+	red := color.NRGBA{R: 255, A: 255}
+
+	padded, info, err := applyCrop(img, CropSpec{Mode: CropPad, Pad: PadBackground{Color: red}})
+	if err != nil {
+		t.Fatalf("applyCrop failed: %v", err)
+	}
+
+	if padded.Bounds() != image.Rect(0, 0, 200, 200) {
+		t.Fatalf("expected 200x200 canvas, got %v", padded.Bounds())
+	}
+
+	if info.Rect != img.Bounds() {
+		t.Errorf("expected whole source to be kept, got %v", info.Rect)
+	}
+
+	// letterbox row is the pad color, middle row is the source
+	if got := color.NRGBAModel.Convert(padded.At(100, 10)); got != red {
+		t.Errorf("expected pad color at top, got %v", got)
+	}
+
+	if got := color.NRGBAModel.Convert(padded.At(100, 100)); got != (color.NRGBA{R: 200, G: 100, B: 50, A: 255}) {
+		t.Errorf("expected source color in the middle, got %v", got)
+	}
+
+	// blurred background has no hard pad color
+	blurred, _, err := applyCrop(img, CropSpec{Mode: CropPad, Pad: PadBackground{Blur: true}})
+	if err != nil {
+		t.Fatalf("applyCrop failed: %v", err)
+	}
+
+	if got := color.NRGBAModel.Convert(blurred.At(100, 10)).(color.NRGBA); got.A != 255 || got == red {
+		t.Errorf("expected opaque blurred background, got %v", got)
+	}
+}
+
+// TestCompress_PadTransparentJPEG() - test that a transparent pad is refused for formats without alpha instead of turning black
+/* t (*testing.T) - testing object */
+func TestCompress_PadTransparentJPEG(t *testing.T) {
+	td := t.TempDir()
+	inPath := filepath.Join(td, "wide.png")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, makeTestImage(200, 100)); err != nil {
+		t.Fatalf("png encode: %v", err)
+	}
+	os.WriteFile(inPath, buf.Bytes(), 0644)
+
+	transparent, _ := ParsePadBackground("transparent")
+	translucent, _ := ParsePadBackground("#ffffff80")
+	for _, bg := range []PadBackground{transparent, translucent} {
+		opts := Options{MaxSize: 1024 * 1024, OutputFormat: "jpg", Crop: CropSpec{Mode: CropPad, Pad: bg}}
+		if _, err := Compress(inPath, filepath.Join(td, "out.jpg"), opts); err == nil {
+			t.Errorf("expected error for pad %v as jpeg", bg.Color)
+		}
+
+		if _, err := CompressVariants(inPath, []VariantSpec{{Size: 64, Format: "jpeg", MaxSize: 1024 * 1024}}, opts); err == nil {
+			t.Errorf("expected error for pad %v in a jpeg variant", bg.Color)
+		}
+	}
+
+	// opaque colors, blur and formats with alpha are fine
+	if err := CheckPadAlpha(CropSpec{Mode: CropPad, Pad: PadBackground{Blur: true}}, "jpeg"); err != nil {
+		t.Errorf("expected blur to be accepted for jpeg, got %v", err)
+	}
+
+	white, _ := ParsePadBackground("white")
+	if err := CheckPadAlpha(CropSpec{Mode: CropPad, Pad: white}, "jpeg"); err != nil {
+		t.Errorf("expected white to be accepted for jpeg, got %v", err)
+	}
+
+	opts := Options{MaxSize: 1024 * 1024, OutputFormat: "png", Crop: CropSpec{Mode: CropPad, Pad: transparent}}
+	if _, err := Compress(inPath, filepath.Join(td, "out.png"), opts); err != nil {
+		t.Fatalf("Compress as png failed: %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(td, "out.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("png decode: %v", err)
+	}
+
+	if _, _, _, a := img.At(img.Bounds().Dx()/2, 0).RGBA(); a != 0 {
+		t.Errorf("expected a transparent letterbox in the png, alpha %d", a>>8)
+	}
+}
@@ -0,0 +1,353 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// placeholderSampleSize bounds the side of the thumbnail hashes are computed from,
+// both hashes only keep a handful of low frequencies so more pixels add nothing
+const placeholderSampleSize = 100
+
+// blurHashChars is the base83 alphabet of the BlurHash format
+const blurHashChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Placeholder holds tiny image hashes a page can render while the full image loads
+/* BlurHash (string) - BlurHash with 4x3 components, 3x4 for portrait images
+   ThumbHash (string) - standard base64 encoded ThumbHash */
+type Placeholder struct {
+	BlurHash  string
+	ThumbHash string
+}
+
+// ComputePlaceholder() - compute the BlurHash and ThumbHash of an image
+/* img (image.Image) - image to hash */
+func ComputePlaceholder(img image.Image) (Placeholder, error) {
+	if img.Bounds().Empty() {
+		return Placeholder{}, fmt.Errorf("cannot hash an empty image")
+	}
+
+	small := imaging.Fit(img, placeholderSampleSize, placeholderSampleSize, imaging.Box)
+
+	x, y := 4, 3
+	if small.Bounds().Dy() > small.Bounds().Dx() {
+		x, y = 3, 4
+	}
+
+	blur, err := BlurHash(small, x, y)
+	if err != nil {
+		return Placeholder{}, err
+	}
+
+	thumb, err := ThumbHash(small)
+	if err != nil {
+		return Placeholder{}, err
+	}
+
+	return Placeholder{BlurHash: blur, ThumbHash: base64.StdEncoding.EncodeToString(thumb)}, nil
+}
+
+// PlaceholderFile() - decode an existing image file and compute its placeholder hashes
+/* path (string) - image file in any supported input format */
+func PlaceholderFile(path string) (Placeholder, image.Rectangle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Placeholder{}, image.Rectangle{}, err
+	}
+	defer f.Close()
+
+	img, _, err := DecodeImage(f)
+	if err != nil {
+		return Placeholder{}, image.Rectangle{}, fmt.Errorf("failed to decode %s: %v", path, err)
+	}
+
+	p, err := ComputePlaceholder(img)
+	return p, img.Bounds(), err
+}
+
+// placeholderFromBuffer() - decode an encoded output and compute its placeholder hashes
+/* buf (*bytes.Buffer) - encoded output */
+func placeholderFromBuffer(buf *bytes.Buffer) (Placeholder, error) {
+	img, _, err := DecodeImage(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return Placeholder{}, fmt.Errorf("failed to decode output for placeholder: %v", err)
+	}
+
+	return ComputePlaceholder(img)
+}
+
+// BlurHash() - encode an image as a BlurHash string
+/* img (image.Image) - image to encode, ideally already downscaled
+   xComponents, yComponents (int) - number of horizontal and vertical components, 1 to 9 each */
+func BlurHash(img image.Image, xComponents, yComponents int) (string, error) {
+	if xComponents < 1 || xComponents > 9 || yComponents < 1 || yComponents > 9 {
+		return "", fmt.Errorf("blurhash components must be between 1 and 9, got %dx%d", xComponents, yComponents)
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// linear RGB of every pixel, read once
+	pixels := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			pixels[y*w+x] = [3]float64{srgbToLinear(c.R), srgbToLinear(c.G), srgbToLinear(c.B)}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			norm := 2.0
+			if i == 0 && j == 0 {
+				norm = 1
+			}
+
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				fy := math.Cos(math.Pi * float64(j) * float64(y) / float64(h))
+				for x := 0; x < w; x++ {
+					basis := fy * math.Cos(math.Pi*float64(i)*float64(x)/float64(w))
+					p := pixels[y*w+x]
+					f[0] += basis * p[0]
+					f[1] += basis * p[1]
+					f[2] += basis * p[2]
+				}
+			}
+
+			scale := norm / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(encode83((xComponents-1)+(yComponents-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+
+	maxValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		b.WriteString(encode83(quantisedMax, 1))
+	} else {
+		b.WriteString(encode83(0, 1))
+	}
+
+	b.WriteString(encode83(linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4))
+
+	for _, f := range ac {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+		}
+		b.WriteString(encode83(quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2))
+	}
+
+	return b.String(), nil
+}
+
+// ThumbHash() - encode an image as a ThumbHash, which also keeps alpha and the aspect ratio
+/* img (image.Image) - image to encode, at most 100x100 pixels */
+func ThumbHash(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w < 1 || h < 1 || w > 100 || h > 100 {
+		return nil, fmt.Errorf("thumbhash needs an image of at most 100x100 pixels, got %dx%d", w, h)
+	}
+
+	// average color, weighted by alpha
+	rgba := make([][4]float64, w*h)
+	var avgR, avgG, avgB, avgA float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			p := [4]float64{float64(c.R) / 255, float64(c.G) / 255, float64(c.B) / 255, float64(c.A) / 255}
+			rgba[y*w+x] = p
+
+			avgR += p[3] * p[0]
+			avgG += p[3] * p[1]
+			avgB += p[3] * p[2]
+			avgA += p[3]
+		}
+	}
+
+	if avgA > 0 {
+		avgR, avgG, avgB = avgR/avgA, avgG/avgA, avgB/avgA
+	}
+
+	hasAlpha := avgA < float64(w*h)
+	lLimit := 7.0
+	if hasAlpha {
+		lLimit = 5 // fewer luminance bits leave room for alpha
+	}
+
+	longest := float64(max(w, h))
+	lx := max(1, int(jsRound(lLimit*float64(w)/longest)))
+	ly := max(1, int(jsRound(lLimit*float64(h)/longest)))
+
+	// convert to luminance, yellow-blue, red-green and alpha, composited atop the average color
+	l := make([]float64, w*h)
+	p := make([]float64, w*h)
+	q := make([]float64, w*h)
+	a := make([]float64, w*h)
+	for i, px := range rgba {
+		r := avgR*(1-px[3]) + px[3]*px[0]
+		g := avgG*(1-px[3]) + px[3]*px[1]
+		b := avgB*(1-px[3]) + px[3]*px[2]
+
+		l[i] = (r + g + b) / 3
+		p[i] = (r+g)/2 - b
+		q[i] = r - g
+		a[i] = px[3]
+	}
+
+	lDC, lAC, lScale := thumbHashChannel(l, w, h, max(3, lx), max(3, ly))
+	pDC, pAC, pScale := thumbHashChannel(p, w, h, 3, 3)
+	qDC, qAC, qScale := thumbHashChannel(q, w, h, 3, 3)
+
+	var aDC, aScale float64
+	var aAC []float64
+	if hasAlpha {
+		aDC, aAC, aScale = thumbHashChannel(a, w, h, 5, 5)
+	}
+
+	isLandscape := w > h
+	header24 := int(jsRound(63*lDC)) | int(jsRound(31.5+31.5*pDC))<<6 | int(jsRound(31.5+31.5*qDC))<<12 | int(jsRound(31*lScale))<<18
+	if hasAlpha {
+		header24 |= 1 << 23
+	}
+
+	header16 := int(jsRound(63*pScale))<<3 | int(jsRound(63*qScale))<<9
+	if isLandscape {
+		header16 |= ly | 1<<15
+	} else {
+		header16 |= lx
+	}
+
+	hash := []byte{byte(header24), byte(header24 >> 8), byte(header24 >> 16), byte(header16), byte(header16 >> 8)}
+	if hasAlpha {
+		hash = append(hash, byte(int(jsRound(15*aDC))|int(jsRound(15*aScale))<<4))
+	}
+
+	// pack the AC terms as 4-bit values, two per byte
+	channels := [][]float64{lAC, pAC, qAC}
+	if hasAlpha {
+		channels = append(channels, aAC)
+	}
+
+	acStart, acIndex := len(hash), 0
+	for _, ac := range channels {
+		for _, f := range ac {
+			pos := acStart + acIndex>>1
+			if pos == len(hash) {
+				hash = append(hash, 0)
+			}
+
+			hash[pos] |= byte(int(jsRound(15*f)) << ((acIndex & 1) << 2))
+			acIndex++
+		}
+	}
+
+	return hash, nil
+}
+
+// thumbHashChannel() - run the DCT of one channel, returns the DC term, the AC terms normalized to 0..1 and their scale
+/* channel ([]float64) - channel values row by row; w, h (int) - image size
+   nx, ny (int) - number of horizontal and vertical frequencies, the upper-left triangle is kept */
+func thumbHashChannel(channel []float64, w, h, nx, ny int) (float64, []float64, float64) {
+	var dc, scale float64
+	var ac []float64
+
+	fx := make([]float64, w)
+	for cy := 0; cy < ny; cy++ {
+		for cx := 0; cx*ny < nx*(ny-cy); cx++ {
+			for x := 0; x < w; x++ {
+				fx[x] = math.Cos(math.Pi / float64(w) * float64(cx) * (float64(x) + 0.5))
+			}
+
+			f := 0.0
+			for y := 0; y < h; y++ {
+				fy := math.Cos(math.Pi / float64(h) * float64(cy) * (float64(y) + 0.5))
+				for x := 0; x < w; x++ {
+					f += channel[x+y*w] * fx[x] * fy
+				}
+			}
+			f /= float64(w * h)
+
+			if cx > 0 || cy > 0 {
+				ac = append(ac, f)
+				scale = math.Max(scale, math.Abs(f))
+			} else {
+				dc = f
+			}
+		}
+	}
+
+	if scale > 0 {
+		for i := range ac {
+			ac[i] = 0.5 + 0.5/scale*ac[i]
+		}
+	}
+
+	return dc, ac, scale
+}
+
+// encode83() - encode value as length base83 digits, most significant first
+/* value (int) - number to encode; length (int) - number of digits */
+func encode83(value, length int) string {
+	out := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		out[i] = blurHashChars[value%83]
+		value /= 83
+	}
+
+	return string(out)
+}
+
+// srgbToLinear() - convert an 8-bit sRGB channel to linear light
+/* v (uint8) - channel value */
+func srgbToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB() - convert linear light back to an 8-bit sRGB channel
+/* v (float64) - linear value, clamped to 0..1 */
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+// signPow() - raise the magnitude of v to exp, keeping its sign
+/* v (float64) - base; exp (float64) - exponent */
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+// jsRound() - round half up like JavaScript's Math.round, which the ThumbHash reference encoder uses
+/* v (float64) - value to round */
+func jsRound(v float64) float64 {
+	return math.Floor(v + 0.5)
+}
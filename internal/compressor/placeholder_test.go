@@ -0,0 +1,95 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBlurHash_SolidColor() - test the BlurHash of a flat image against the hand-computed encoding
+/* t (*testing.T) - testing object */
+func TestBlurHash_SolidColor(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 24))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+
+	// a single component is just the size flag, a zero max and the pure red DC term
+	hash, err := BlurHash(img, 1, 1)
+	if err != nil || hash != "00TI:j" {
+		t.Errorf("expected 00TI:j, got %s (%v)", hash, err)
+	}
+
+	// 4x3 is flagged as 3 + 2*9 = 21 -> L and carries 11 AC terms of two digits each
+	hash, err = BlurHash(img, 4, 3)
+	if err != nil || !strings.HasPrefix(hash, "L") || hash[2:6] != "TI:j" || len(hash) != 6+2*11 {
+		t.Errorf("unexpected 4x3 hash %s (%v)", hash, err)
+	}
+
+	if _, err := BlurHash(img, 0, 10); err == nil {
+		t.Error("expected error for out-of-range components")
+	}
+}
+
+// TestThumbHash_SolidColor() - test the ThumbHash header and length of a flat opaque image
+/* t (*testing.T) - testing object */
+func TestThumbHash_SolidColor(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+
+	hash, err := ThumbHash(img)
+	if err != nil {
+		t.Fatalf("ThumbHash failed: %v", err)
+	}
+
+	// L 1/3, P 0.5, Q 1, no alpha, 7x7 luminance terms on a square image
+	if !bytes.Equal(hash[:5], []byte{213, 251, 3, 7, 0}) || len(hash) != 24 {
+		t.Errorf("unexpected hash % x (%d bytes)", hash, len(hash))
+	}
+
+	if _, err := ThumbHash(image.NewRGBA(image.Rect(0, 0, 101, 10))); err == nil {
+		t.Error("expected error for an image wider than 100px")
+	}
+}
+
+// TestComputePlaceholder() - test orientation handling and placeholders from files and compression runs
+/* t (*testing.T) - testing object */
+func TestComputePlaceholder(t *testing.T) {
+	p, err := ComputePlaceholder(makeNoiseImage(300, 600, 4))
+	if err != nil {
+		t.Fatalf("ComputePlaceholder failed: %v", err)
+	}
+
+	// portrait images use 3x4 components, flagged as 2 + 3*9 = 29 -> T
+	if !strings.HasPrefix(p.BlurHash, "T") || len(p.BlurHash) != 4+2+2*11 {
+		t.Errorf("unexpected portrait BlurHash %s", p.BlurHash)
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(p.ThumbHash); err != nil {
+		t.Errorf("ThumbHash is not base64: %v", err)
+	}
+
+	inPath := filepath.Join(t.TempDir(), "in.png")
+	var buf bytes.Buffer
+	png.Encode(&buf, makeTestImage(400, 300))
+	os.WriteFile(inPath, buf.Bytes(), 0644)
+
+	fromFile, bounds, err := PlaceholderFile(inPath)
+	if err != nil || bounds.Dx() != 400 || fromFile.BlurHash == "" {
+		t.Fatalf("PlaceholderFile failed: %+v %v (%v)", fromFile, bounds, err)
+	}
+
+	result, err := Compress(inPath, "", Options{MaxSize: 1 << 20, OutputFormat: "jpeg", Quality: 80, DryRun: true, Placeholder: true})
+	if err != nil || result.Placeholder == nil || result.Placeholder.BlurHash == "" {
+		t.Fatalf("expected a placeholder in the result, got %+v (%v)", result, err)
+	}
+
+	if result, _ := Compress(inPath, "", Options{MaxSize: 1 << 20, OutputFormat: "jpeg", DryRun: true}); result.Placeholder != nil {
+		t.Error("expected no placeholder unless requested")
+	}
+}
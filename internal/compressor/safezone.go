@@ -0,0 +1,115 @@
+package compressor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// SafeZoneThreshold is the share of detail outside the inscribed circle above which content is considered clipped
+const SafeZoneThreshold = 0.30
+
+// safeZoneSampleSize is the side of the square sample the safe-zone analysis works on
+const safeZoneSampleSize = 128
+
+// SafeZoneReport describes how much of an image's detail falls outside the circle avatars are displayed in
+/* OutsideRatio (float64) - share of edge and color energy in the corners outside the inscribed circle
+   OutsideArea (float64) - share of the square's area outside the circle, for comparison (about 0.21)
+   Clipped (bool) - whether OutsideRatio exceeds SafeZoneThreshold */
+type SafeZoneReport struct {
+	OutsideRatio float64
+	OutsideArea  float64
+	Clipped      bool
+}
+
+// Warning() - describe the report as a user-facing warning, returns an empty string when nothing is clipped
+// r (SafeZoneReport) - report to describe
+func (r SafeZoneReport) Warning() string {
+	if !r.Clipped {
+		return ""
+	}
+
+	return fmt.Sprintf("%.0f%% of the image detail lies outside the circular safe zone and may be hidden by circular avatars",
+		r.OutsideRatio*100)
+}
+
+// AnalyzeSafeZone() - measure the detail outside the circle inscribed in the image's center square
+/* img (image.Image) - image to analyze; non-square images are measured on the center square platforms would show */
+func AnalyzeSafeZone(img image.Image) SafeZoneReport {
+	square := imaging.Crop(img, centerSquare(img.Bounds()))
+	sample := imaging.Resize(square, safeZoneSampleSize, safeZoneSampleSize, imaging.Box)
+	energy := detailEnergy(sample)
+
+	var inside, outside float64
+	outsidePixels := 0
+	for y := 0; y < safeZoneSampleSize; y++ {
+		for x := 0; x < safeZoneSampleSize; x++ {
+			e := energy[y*safeZoneSampleSize+x]
+			if insideCircle(x, y, safeZoneSampleSize) {
+				inside += e
+			} else {
+				outside += e
+				outsidePixels++
+			}
+		}
+	}
+
+	report := SafeZoneReport{
+		OutsideArea: float64(outsidePixels) / float64(safeZoneSampleSize*safeZoneSampleSize),
+	}
+
+	if total := inside + outside; total > 0 {
+		report.OutsideRatio = outside / total
+	}
+
+	report.Clipped = report.OutsideRatio > SafeZoneThreshold
+	return report
+}
+
+// CirclePreview() - render the center square of img with everything outside the inscribed circle made transparent
+/* img (image.Image) - image to preview */
+func CirclePreview(img image.Image) *image.NRGBA {
+	preview := imaging.Crop(img, centerSquare(img.Bounds()))
+	size := preview.Bounds().Dx()
+	r := float64(size) / 2
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			// distance from the pixel center, with a one-pixel antialiased edge
+			d := math.Hypot(float64(x)+0.5-r, float64(y)+0.5-r)
+			coverage := math.Max(0, math.Min(1, r-d+0.5))
+
+			i := preview.PixOffset(x, y)
+			preview.Pix[i+3] = uint8(float64(preview.Pix[i+3]) * coverage)
+		}
+	}
+
+	return preview
+}
+
+// SaveCirclePreview() - write a PNG of the image at imagePath with the circular avatar mask applied
+/* imagePath (string) - image to preview; previewPath (string) - where to write the PNG */
+func SaveCirclePreview(imagePath, previewPath string) error {
+	img, _, err := loadImage(imagePath)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, CirclePreview(img)); err != nil {
+		return fmt.Errorf("failed to encode preview: %v", err)
+	}
+
+	return saveBufferToFile(previewPath, &buf)
+}
+
+// insideCircle() - report whether pixel (x, y) lies inside the circle inscribed in a size x size square
+/* x, y (int) - pixel coordinates; size (int) - side of the square */
+func insideCircle(x, y, size int) bool {
+	r := float64(size) / 2
+	return math.Hypot(float64(x)+0.5-r, float64(y)+0.5-r) <= r
+}
@@ -0,0 +1,124 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeCornerImage() - create a flat square image with checkerboard detail only in its four corners
+/* size (int) - side of the image; corner (int) - side of each detailed corner */
+func makeCornerImage(size, corner int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			inCorner := (x < corner || x >= size-corner) && (y < corner || y >= size-corner)
+			if inCorner && (x/3+y/3)%2 == 0 {
+				img.Set(x, y, color.RGBA{A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{R: 240, G: 240, B: 240, A: 255})
+			}
+		}
+	}
+
+	return img
+}
+
+// TestAnalyzeSafeZone() - test that detail in the corners is flagged and centered detail is not
+/* t (*testing.T) - testing object */
+func TestAnalyzeSafeZone(t *testing.T) {
+	corners := AnalyzeSafeZone(makeCornerImage(256, 50))
+	if !corners.Clipped || corners.Warning() == "" {
+		t.Errorf("expected corner detail to be clipped, got %+v", corners)
+	}
+
+	centered := AnalyzeSafeZone(makeSubjectImage(256, 256, 78, 78, 100))
+	if centered.Clipped || centered.Warning() != "" {
+		t.Errorf("expected centered detail to be safe, got %+v", centered)
+	}
+
+	if centered.OutsideArea < 0.2 || centered.OutsideArea > 0.23 {
+		t.Errorf("expected outside area near 0.21, got %v", centered.OutsideArea)
+	}
+
+	// evenly spread energy lands outside in proportion to the area
+	if flat := AnalyzeSafeZone(makeTestImage(100, 100)); flat.Clipped || flat.OutsideRatio > flat.OutsideArea+0.01 {
+		t.Errorf("expected flat image to be safe, got %+v", flat)
+	}
+}
+
+// TestCompress_SafeZone() - test that the safe zone is only analyzed when asked for
+/* t (*testing.T) - testing object */
+func TestCompress_SafeZone(t *testing.T) {
+	inPath := filepath.Join(t.TempDir(), "corners.png")
+	var buf bytes.Buffer
+	png.Encode(&buf, makeCornerImage(256, 50))
+	if err := os.WriteFile(inPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{MaxSize: 1 << 20, OutputFormat: "png", DryRun: true}
+	result, err := Compress(inPath, "", opts)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	if result.SafeZone.Clipped || len(result.Warnings) != 0 {
+		t.Errorf("expected no safe zone analysis by default, got %+v %v", result.SafeZone, result.Warnings)
+	}
+
+	opts.SafeZone = true
+	if result, err = Compress(inPath, "", opts); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	if !result.SafeZone.Clipped || len(result.Warnings) != 1 {
+		t.Errorf("expected a safe zone warning, got %+v %v", result.SafeZone, result.Warnings)
+	}
+}
+
+// TestCirclePreview() - test that the preview masks the corners and keeps the center
+/* t (*testing.T) - testing object */
+func TestCirclePreview(t *testing.T) {
+	preview := CirclePreview(makeTestImage(200, 100))
+
+	if preview.Bounds().Dx() != 100 || preview.Bounds().Dy() != 100 {
+		t.Fatalf("expected 100x100 preview, got %v", preview.Bounds())
+	}
+
+	if a := preview.NRGBAAt(0, 0).A; a != 0 {
+		t.Errorf("expected transparent corner, got alpha %d", a)
+	}
+
+	if a := preview.NRGBAAt(50, 50).A; a != 255 {
+		t.Errorf("expected opaque center, got alpha %d", a)
+	}
+}
+
+// TestSaveCirclePreview() - test writing a preview PNG to disk
+/* t (*testing.T) - testing object */
+func TestSaveCirclePreview(t *testing.T) {
+	td := t.TempDir()
+	inPath := filepath.Join(td, "in.png")
+	outPath := filepath.Join(td, "preview.png")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, makeTestImage(80, 80)); err != nil {
+		t.Fatalf("png encode: %v", err)
+	}
+
+	if err := os.WriteFile(inPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("write in file: %v", err)
+	}
+
+	if err := SaveCirclePreview(inPath, outPath); err != nil {
+		t.Fatalf("SaveCirclePreview failed: %v", err)
+	}
+
+	if _, w, err := loadImage(outPath); err != nil || w != 80 {
+		t.Fatalf("expected readable 80px preview, got width %d, err %v", w, err)
+	}
+}
@@ -0,0 +1,86 @@
+package compressor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxSizeBytes bounds parsed sizes well above any image gitfit handles, keeping int math safe
+const maxSizeBytes = 1 << 40
+
+// sizePattern splits a size into its number and unit
+var sizePattern = regexp.MustCompile(`^([0-9]*\.?[0-9]+)\s*([a-zA-Z]*)$`)
+
+// sizeUnits maps lowercase units to bytes: KB and MB are decimal, KiB, MiB and the bare k and m are binary
+var sizeUnits = map[string]int64{
+	"": 1, "b": 1,
+	"k": 1 << 10, "kib": 1 << 10, "kb": 1000,
+	"m": 1 << 20, "mib": 1 << 20, "mb": 1000 * 1000,
+	"g": 1 << 30, "gib": 1 << 30, "gb": 1000 * 1000 * 1000,
+}
+
+// Size is a parsed size target, either absolute or relative to the input
+/* Bytes (int) - absolute size, 0 when relative; Percent (float64) - share of the input size, 0 when absolute */
+type Size struct {
+	Bytes   int
+	Percent float64
+}
+
+// ParseSize() - parse a size such as 1048576, 500KB, 1MiB or 750k, or a share of the input such as 50%
+/* spec (string) - size to parse */
+func ParseSize(spec string) (Size, error) {
+	spec = strings.TrimSpace(spec)
+
+	if pct, ok := strings.CutSuffix(spec, "%"); ok {
+		p, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return Size{}, fmt.Errorf("invalid size %q: a percentage must be above 0%% and at most 100%%", spec)
+		}
+
+		return Size{Percent: p}, nil
+	}
+
+	m := sizePattern.FindStringSubmatch(spec)
+	if m == nil {
+		return Size{}, fmt.Errorf("invalid size %q: expected bytes or a value such as 500KB, 1MiB, 750k or 50%%", spec)
+	}
+
+	unit, ok := sizeUnits[strings.ToLower(m[2])]
+	if !ok {
+		return Size{}, fmt.Errorf("invalid size %q: unknown unit %q (use B, KB, KiB, k, MB, MiB, m, GB, GiB or g)", spec, m[2])
+	}
+
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return Size{}, fmt.Errorf("invalid size %q: %v", spec, err)
+	}
+
+	bytes := n * float64(unit)
+	if bytes < 1 || bytes > maxSizeBytes {
+		return Size{}, fmt.Errorf("invalid size %q: must be between 1 byte and 1TiB", spec)
+	}
+
+	return Size{Bytes: int(bytes)}, nil
+}
+
+// Resolve() - turn the size into bytes for an input of the given size
+// s (Size) - size to resolve
+func (s Size) Resolve(inputSize int64) int {
+	if s.Percent == 0 {
+		return s.Bytes
+	}
+
+	return max(1, int(float64(inputSize)*s.Percent/100))
+}
+
+// String() - format the size the way ParseSize() reads it back
+// s (Size) - size to format
+func (s Size) String() string {
+	if s.Percent > 0 {
+		return strconv.FormatFloat(s.Percent, 'f', -1, 64) + "%"
+	}
+
+	return strconv.Itoa(s.Bytes)
+}
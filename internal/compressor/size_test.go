@@ -0,0 +1,39 @@
+package compressor
+
+import "testing"
+
+// TestParseSize() - test units, percentages and malformed sizes
+/* t (*testing.T) - testing object */
+func TestParseSize(t *testing.T) {
+	tests := map[string]Size{
+		"1048576": {Bytes: 1048576},
+		"1MB":     {Bytes: 1000000},
+		"1MiB":    {Bytes: 1048576},
+		"500KB":   {Bytes: 500000},
+		"500 kb":  {Bytes: 500000},
+		"750k":    {Bytes: 750 * 1024},
+		"1.5M":    {Bytes: 1572864},
+		"50%":     {Percent: 50},
+	}
+
+	for spec, want := range tests {
+		got, err := ParseSize(spec)
+		if err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %+v (%v), expected %+v", spec, got, err, want)
+		}
+	}
+
+	for _, bad := range []string{"", "abc", "-5", "0", "10XB", "0%", "150%", "5TB"} {
+		if _, err := ParseSize(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+
+	if n := (Size{Percent: 50}).Resolve(3000); n != 1500 {
+		t.Errorf("expected 50%% of 3000 to be 1500, got %d", n)
+	}
+
+	if n := (Size{Bytes: 42}).Resolve(3000); n != 42 {
+		t.Errorf("expected absolute size to ignore the input, got %d", n)
+	}
+}
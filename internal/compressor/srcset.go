@@ -0,0 +1,255 @@
+package compressor
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultSrcsetWidths is the width ladder used when none is given
+var DefaultSrcsetWidths = []int{320, 640, 960, 1280, 1920}
+
+// srcsetMinWidth is the smallest width the size search may fall back to for a rung
+const srcsetMinWidth = 100
+
+// SrcsetImage is one rung of a responsive image ladder
+/* Width, Height (int) - dimensions of the encoded image; Format (string) - output format
+   Quality (int) - quality used for formats with a quality knob; Data ([]byte) - encoded image */
+type SrcsetImage struct {
+	Width   int
+	Height  int
+	Format  string
+	Quality int
+	Data    []byte
+}
+
+// Filename() - name the image after base, its width and its format's extension, e.g. hero-640.jpg
+// i (SrcsetImage) - image to name
+func (i SrcsetImage) Filename(base string) string {
+	ext := ".img"
+	if enc, ok := LookupEncoder(i.Format); ok {
+		ext = enc.Extensions()[0]
+	}
+
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(base, filepath.Ext(base)), i.Width, ext)
+}
+
+// URL() - reference the image under prefix, escaping each path segment of its file name
+/* i (SrcsetImage) - image to reference; base (string) - name the files were written under
+   prefix (string) - URL prefix for the files, used as given
+
+   Spaces and commas would split a srcset candidate and parentheses would end a Markdown link. */
+func (i SrcsetImage) URL(base, prefix string) string {
+	segments := strings.Split(i.Filename(base), "/")
+	for n, segment := range segments {
+		segments[n] = url.PathEscape(segment)
+	}
+
+	return prefix + strings.Join(segments, "/")
+}
+
+// Srcset holds a width ladder of compressed images in one or more formats
+/* Images ([]SrcsetImage) - every encoded image, grouped by format in Formats order and sorted by width
+   Formats ([]string) - formats in order of preference, the last one is the <img> fallback */
+type Srcset struct {
+	Images  []SrcsetImage
+	Formats []string
+}
+
+// ParseWidths() - parse a comma-separated width ladder, empty or "default" for DefaultSrcsetWidths
+/* spec (string) - widths such as 320,640,1280 */
+func ParseWidths(spec string) ([]int, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "default" {
+		return append([]int(nil), DefaultSrcsetWidths...), nil
+	}
+
+	var widths []int
+	for _, field := range strings.Split(spec, ",") {
+		w, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || w < 1 || w > MaxVariantSize {
+			return nil, fmt.Errorf("invalid width %q: must be between 1 and %d", field, MaxVariantSize)
+		}
+		widths = append(widths, w)
+	}
+
+	return widths, nil
+}
+
+// ParseFormats() - parse a comma-separated list of output formats into canonical names
+/* spec (string) - formats such as png,jpeg; fallback (string) - format used when spec is empty */
+func ParseFormats(spec, fallback string) ([]string, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = fallback
+	}
+
+	var formats []string
+	for _, field := range strings.Split(spec, ",") {
+		enc, ok := LookupEncoder(field)
+		if !ok {
+			return nil, fmt.Errorf("unsupported format %q", strings.TrimSpace(field))
+		}
+		formats = append(formats, enc.Name())
+	}
+
+	return formats, nil
+}
+
+// CompressSrcset() - decode the input once and compress it at every width of the ladder in every format
+/* inputPath (string) - path of the input image; widths ([]int) - width ladder, wider than the source is skipped
+   formats ([]string) - output formats in order of preference; opts (Options) - shared settings, MaxSize caps every image
+
+   Each rung runs the usual size search with the rung as its largest width, so a rung may come out
+   narrower when MaxSize cannot be met; rungs that collapse onto the same width are dropped. */
+func CompressSrcset(inputPath string, widths []int, formats []string, opts Options) (*Srcset, error) {
+	if err := CheckPadAlpha(opts.Crop, formats...); err != nil {
+		return nil, err
+	}
+
+	img, _, err := prepareSource(inputPath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	srcWidth := img.Bounds().Dx()
+
+	// no upscaling: keep rungs up to the source width, or the source width alone
+	var ladder []int
+	for _, w := range widths {
+		if w <= srcWidth {
+			ladder = append(ladder, w)
+		}
+	}
+	if len(ladder) == 0 {
+		ladder = []int{srcWidth}
+	}
+	sort.Ints(ladder)
+
+	set := &Srcset{Formats: formats}
+	for _, format := range formats {
+		fo := opts
+		fo.OutputFormat = format
+
+		last := 0
+		for _, w := range ladder {
+			best, buf, err := findLargestUnderSize(img, min(srcsetMinWidth, w), w, fo)
+			if err != nil {
+				return nil, fmt.Errorf("%dw %s: %w", w, format, err)
+			}
+
+			if best == last {
+				continue
+			}
+			last = best
+
+			entry := SrcsetImage{Width: best, Height: scaledHeight(img.Bounds(), best), Format: format, Data: buf.Bytes()}
+			if enc, ok := LookupEncoder(format); ok && HasKnob(enc, "quality") {
+				entry.Quality = fo.Quality
+			}
+
+			if opts.Verbose {
+				fmt.Fprintf(LogOutput, "srcset %s %dw: %.2f KB\n", format, best, float64(buf.Len())/1024.0)
+			}
+
+			set.Images = append(set.Images, entry)
+		}
+	}
+
+	return set, nil
+}
+
+// ByFormat() - list the images of one format, narrowest first
+// s (*Srcset) - ladder to filter
+func (s *Srcset) ByFormat(format string) []SrcsetImage {
+	var images []SrcsetImage
+	for _, entry := range s.Images {
+		if entry.Format == format {
+			images = append(images, entry)
+		}
+	}
+
+	return images
+}
+
+// HTML() - build a <picture> element with one <source> per preferred format and an <img> fallback
+/* s (*Srcset) - ladder to reference; base (string) - name the files were written under
+   prefix (string) - URL prefix for the files, e.g. /img/; alt (string) - alternative text */
+func (s *Srcset) HTML(base, prefix, alt string) string {
+	if len(s.Formats) == 0 {
+		return ""
+	}
+
+	fallback := s.ByFormat(s.Formats[len(s.Formats)-1])
+	if len(fallback) == 0 {
+		return ""
+	}
+
+	largest := fallback[len(fallback)-1]
+	sizes := fmt.Sprintf("(max-width: %dpx) 100vw, %dpx", largest.Width, largest.Width)
+
+	var b strings.Builder
+	b.WriteString("<picture>\n")
+	for _, format := range s.Formats[:len(s.Formats)-1] {
+		enc, _ := LookupEncoder(format)
+		fmt.Fprintf(&b, "  <source type=\"%s\" srcset=\"%s\" sizes=\"%s\">\n",
+			enc.MIMEType(), srcsetAttr(s.ByFormat(format), base, prefix), sizes)
+	}
+
+	fmt.Fprintf(&b, "  <img src=\"%s\" srcset=\"%s\" sizes=\"%s\" width=\"%d\" height=\"%d\" alt=\"%s\" loading=\"lazy\" decoding=\"async\">\n",
+		html.EscapeString(largest.URL(base, prefix)), srcsetAttr(fallback, base, prefix), sizes,
+		largest.Width, largest.Height, html.EscapeString(alt))
+	b.WriteString("</picture>\n")
+
+	return b.String()
+}
+
+// Markdown() - build a Markdown image showing a mid-sized rung that links to the largest one
+/* s (*Srcset) - ladder to reference; base (string) - name the files were written under
+   prefix (string) - URL prefix for the files; alt (string) - alternative text
+
+   Markdown has no srcset, so this picks the rung closest to 800px wide for display. */
+func (s *Srcset) Markdown(base, prefix, alt string) string {
+	if len(s.Formats) == 0 {
+		return ""
+	}
+
+	images := s.ByFormat(s.Formats[len(s.Formats)-1])
+	if len(images) == 0 {
+		return ""
+	}
+
+	display := images[0]
+	for _, entry := range images {
+		if abs(entry.Width-800) < abs(display.Width-800) {
+			display = entry
+		}
+	}
+
+	alt = strings.NewReplacer("\\", "\\\\", "[", "\\[", "]", "\\]").Replace(alt)
+	return fmt.Sprintf("[![%s](%s)](%s)\n", alt, display.URL(base, prefix), images[len(images)-1].URL(base, prefix))
+}
+
+// srcsetAttr() - format images as a srcset attribute value
+/* images ([]SrcsetImage) - images of one format; base (string) - file base name; prefix (string) - URL prefix */
+func srcsetAttr(images []SrcsetImage, base, prefix string) string {
+	parts := make([]string, len(images))
+	for i, entry := range images {
+		parts[i] = fmt.Sprintf("%s %dw", entry.URL(base, prefix), entry.Width)
+	}
+
+	return html.EscapeString(strings.Join(parts, ", "))
+}
+
+// abs() - absolute value of an int
+/* n (int) - value */
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -0,0 +1,111 @@
+package compressor
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParseWidths() - test width ladder parsing and defaults
+/* t (*testing.T) - testing object */
+func TestParseWidths(t *testing.T) {
+	widths, err := ParseWidths("")
+	if err != nil || len(widths) != len(DefaultSrcsetWidths) {
+		t.Fatalf("expected default widths, got %v (%v)", widths, err)
+	}
+
+	widths, err = ParseWidths("320, 640")
+	if err != nil || len(widths) != 2 || widths[1] != 640 {
+		t.Fatalf("unexpected widths %v (%v)", widths, err)
+	}
+
+	for _, bad := range []string{"0", "abc", "320,", "99999"} {
+		if _, err := ParseWidths(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+
+	formats, err := ParseFormats("", "jpg")
+	if err != nil || len(formats) != 1 || formats[0] != "jpeg" {
+		t.Errorf("expected fallback to canonical jpeg, got %v (%v)", formats, err)
+	}
+
+	if _, err := ParseFormats("png,bogus", "jpeg"); err == nil {
+		t.Error("expected error for an unknown format")
+	}
+}
+
+// TestCompressSrcset() - test the ladder skips upscaling, fits the budget and renders snippets
+/* t (*testing.T) - testing object */
+func TestCompressSrcset(t *testing.T) {
+	inPath := filepath.Join(t.TempDir(), "in.png")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, makeNoiseImage(700, 350, 5)); err != nil {
+		t.Fatalf("png encode: %v", err)
+	}
+	os.WriteFile(inPath, buf.Bytes(), 0644)
+
+	set, err := CompressSrcset(inPath, []int{1280, 640, 320}, []string{"png", "jpeg"}, Options{MaxSize: 512 * 1024, Quality: 85})
+	if err != nil {
+		t.Fatalf("CompressSrcset failed: %v", err)
+	}
+
+	jpegs := set.ByFormat("jpeg")
+	if len(jpegs) != 2 || jpegs[0].Width != 320 || jpegs[1].Width != 640 {
+		t.Fatalf("expected 320w and 640w jpeg rungs without upscaling, got %+v", jpegs)
+	}
+
+	if jpegs[0].Height != 160 {
+		t.Errorf("expected aspect ratio to be kept, got height %d", jpegs[0].Height)
+	}
+
+	for _, entry := range set.Images {
+		if len(entry.Data) > 512*1024 {
+			t.Errorf("%s %dw: %d bytes exceeds budget", entry.Format, entry.Width, len(entry.Data))
+		}
+	}
+
+	snippet := set.HTML("hero.png", "/img/", `a "hero"`)
+	for _, want := range []string{`<source type="image/png" srcset="/img/hero-320.png 320w, `,
+		`src="/img/hero-640.jpg"`, `width="640" height="320"`, `alt="a &#34;hero&#34;"`} {
+		if !strings.Contains(snippet, want) {
+			t.Errorf("HTML snippet missing %q:\n%s", want, snippet)
+		}
+	}
+
+	if md := set.Markdown("hero.png", "", "hero"); md != "[![hero](hero-640.jpg)](hero-640.jpg)\n" {
+		t.Errorf("unexpected Markdown snippet %q", md)
+	}
+
+	// a source narrower than every rung yields one image at the source width
+	set, err = CompressSrcset(inPath, []int{1920}, []string{"jpeg"}, Options{MaxSize: 512 * 1024, Quality: 85})
+	if err != nil || len(set.Images) != 1 || set.Images[0].Width != 700 {
+		t.Errorf("expected a single 700w image, got %+v (%v)", set, err)
+	}
+}
+
+// TestSrcset_Escaping() - test that file names with spaces, commas and parentheses stay valid in the snippets
+/* t (*testing.T) - testing object */
+func TestSrcset_Escaping(t *testing.T) {
+	set := &Srcset{
+		Formats: []string{"jpeg"},
+		Images:  []SrcsetImage{{Width: 320, Height: 160, Format: "jpeg"}, {Width: 640, Height: 320, Format: "jpeg"}},
+	}
+
+	snippet := set.HTML("my photo, (1).png", "/img/", "me")
+	for _, want := range []string{`src="/img/my%20photo%2C%20%281%29-640.jpg"`,
+		`srcset="/img/my%20photo%2C%20%281%29-320.jpg 320w, /img/my%20photo%2C%20%281%29-640.jpg 640w"`} {
+		if !strings.Contains(snippet, want) {
+			t.Errorf("HTML snippet missing %q:\n%s", want, snippet)
+		}
+	}
+
+	md := set.Markdown("me (old).png", "", `a [b] \`)
+	if want := "[![a \\[b\\] \\\\](me%20%28old%29-640.jpg)](me%20%28old%29-640.jpg)\n"; md != want {
+		t.Errorf("expected Markdown snippet %q, got %q", want, md)
+	}
+}
@@ -0,0 +1,109 @@
+package compressor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+// DefaultSVGSize is the longest side SVGs are rasterized at when no size is requested;
+// the size search then picks the largest width under the size cap from there
+const DefaultSVGSize = 2048
+
+// MaxSVGSize bounds a requested rasterization size
+const MaxSVGSize = 8192
+
+// svgDecoder rasterizes SVG documents with a pure-Go renderer
+/* Size (int) - longest side of the rasterized image in pixels */
+type svgDecoder struct {
+	Size int
+}
+
+func (svgDecoder) Name() string         { return "svg" }
+func (svgDecoder) Extensions() []string { return []string{".svg"} }
+
+// Match() - check for an <svg> root element, skipping a byte order mark, the XML prolog, comments and the doctype,
+// so other XML documents are not mistaken for SVG
+// (svgDecoder) - SVG decoder
+func (svgDecoder) Match(header []byte) bool {
+	header = bytes.TrimPrefix(header, []byte("\xef\xbb\xbf"))
+
+	for {
+		header = bytes.TrimLeft(header, " \t\r\n")
+
+		var end string
+		switch {
+		case bytes.HasPrefix(header, []byte("<?")):
+			end = "?>"
+		case bytes.HasPrefix(header, []byte("<!--")):
+			end = "-->"
+		case bytes.HasPrefix(header, []byte("<!DOCTYPE")):
+			end = ">"
+			// an internal subset can hold > of its own
+			if i := bytes.IndexAny(header, "[>"); i >= 0 && header[i] == '[' {
+				end = "]>"
+			}
+		default:
+			// the root must be <svg itself, not an element whose name only starts with svg
+			rest, ok := bytes.CutPrefix(header, []byte("<svg"))
+			return ok && (len(rest) == 0 || bytes.IndexByte([]byte(" \t\r\n>/"), rest[0]) >= 0)
+		}
+
+		i := bytes.Index(header, []byte(end))
+		if i < 0 {
+			return false
+		}
+		header = header[i+len(end):]
+	}
+}
+
+// Decode() - rasterize the SVG so its longest side is d.Size pixels
+// d (svgDecoder) - SVG decoder
+func (d svgDecoder) Decode(r io.Reader) (image.Image, error) {
+	return RasterizeSVG(r, d.Size)
+}
+
+// RasterizeSVG() - render an SVG document onto a transparent canvas, keeping its aspect ratio
+/* r (io.Reader) - SVG document; size (int) - longest side of the output in pixels, DefaultSVGSize when <= 0 */
+func RasterizeSVG(r io.Reader, size int) (image.Image, error) {
+	if size <= 0 {
+		size = DefaultSVGSize
+	}
+
+	if size > MaxSVGSize {
+		return nil, fmt.Errorf("svg size %d exceeds the maximum of %d", size, MaxSVGSize)
+	}
+
+	icon, err := oksvg.ReadIconStream(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse svg: %v", err)
+	}
+
+	vw, vh := icon.ViewBox.W, icon.ViewBox.H
+	if vw <= 0 || vh <= 0 {
+		return nil, fmt.Errorf("svg has no usable viewBox or width/height")
+	}
+
+	// scale the longer side to size and the other one proportionally
+	scale := float64(size) / math.Max(vw, vh)
+	w := max(1, int(math.Round(vw*scale)))
+	h := max(1, int(math.Round(vh*scale)))
+
+	icon.SetTarget(0, 0, float64(w), float64(h))
+
+	canvas := image.NewRGBA(image.Rect(0, 0, w, h))
+	scanner := rasterx.NewScannerGV(w, h, canvas, canvas.Bounds())
+	icon.Draw(rasterx.NewDasher(w, h, scanner), 1.0)
+
+	return canvas, nil
+}
+
+// init() - register the SVG decoder at the default size
+func init() {
+	RegisterDecoder(svgDecoder{Size: DefaultSVGSize})
+}
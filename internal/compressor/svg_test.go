@@ -0,0 +1,104 @@
+package compressor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testSVG is a 2:1 logo: a red rectangle on the left half, transparent on the right
+const testSVG = `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 100">
+  <rect x="0" y="0" width="100" height="100" fill="#ff0000"/>
+</svg>`
+
+// TestSVGDecoder_Match() - test SVG sniffing with and without a prolog, and that other XML is left alone
+/* t (*testing.T) - testing object */
+func TestSVGDecoder_Match(t *testing.T) {
+	dec := svgDecoder{}
+	for _, header := range []string{
+		testSVG,
+		"\xef\xbb\xbf  <svg xmlns=",
+		"<!-- logo -->\n<svg",
+		"<svg",
+		`<?xml version="1.0"?><!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd"><svg>`,
+		`<!DOCTYPE svg [<!ENTITY a "<b>">]><svg>`,
+	} {
+		if !dec.Match([]byte(header)) {
+			t.Errorf("expected %q to match", header)
+		}
+	}
+
+	for _, header := range []string{
+		"\x89PNG\r\n\x1a\n",
+		`<?xml version="1.0"?><rss version="2.0">`,
+		"<!-- feed --><feed>",
+		`<?xml version="1.0"?>`,
+		"<svgfont>",
+		"<!-- unterminated comment <svg>",
+	} {
+		if dec.Match([]byte(header)) {
+			t.Errorf("expected %q not to match", header)
+		}
+	}
+}
+
+// TestRasterizeSVG() - test that rasterizing keeps the aspect ratio and draws the shapes
+/* t (*testing.T) - testing object */
+func TestRasterizeSVG(t *testing.T) {
+	img, err := RasterizeSVG(strings.NewReader(testSVG), 400)
+	if err != nil {
+		t.Fatalf("RasterizeSVG failed: %v", err)
+	}
+
+	if img.Bounds().Dx() != 400 || img.Bounds().Dy() != 200 {
+		t.Fatalf("expected 400x200, got %v", img.Bounds())
+	}
+
+	if r, _, _, a := img.At(50, 100).RGBA(); r>>8 < 250 || a>>8 < 250 {
+		t.Errorf("expected opaque red on the left, got r=%d a=%d", r>>8, a>>8)
+	}
+
+	if _, _, _, a := img.At(350, 100).RGBA(); a != 0 {
+		t.Errorf("expected transparent right half, got alpha %d", a>>8)
+	}
+
+	if _, err := RasterizeSVG(strings.NewReader(testSVG), MaxSVGSize+1); err == nil {
+		t.Error("expected error for oversized raster")
+	}
+
+	if _, err := RasterizeSVG(strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), 100); err == nil {
+		t.Error("expected error for svg without a size")
+	}
+}
+
+// TestCompress_SVGInput() - test that SVG input goes through cropping and the size search
+/* t (*testing.T) - testing object */
+func TestCompress_SVGInput(t *testing.T) {
+	td := t.TempDir()
+	inPath := filepath.Join(td, "logo.svg")
+	outPath := filepath.Join(td, "logo.png")
+
+	if err := os.WriteFile(inPath, []byte(testSVG), 0644); err != nil {
+		t.Fatalf("write svg: %v", err)
+	}
+
+	result, err := Compress(inPath, outPath, Options{
+		MaxSize:      1024 * 1024,
+		OutputFormat: "png",
+		Crop:         CropSpec{Mode: CropCenter},
+		SVGSize:      300,
+	})
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	if result.Width != 150 || result.Height != 150 {
+		t.Errorf("expected 150x150 center square of a 300x150 raster, got %dx%d", result.Width, result.Height)
+	}
+
+	if format, err := DetectFormat(inPath); err != nil || format != "svg" {
+		t.Errorf("expected svg to be detected, got %q (%v)", format, err)
+	}
+}
@@ -0,0 +1,215 @@
+package compressor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// DefaultVariantSizes are the avatar sizes generated when no variant list is given
+var DefaultVariantSizes = []int{32, 64, 128, 256, 512}
+
+// MaxVariantSize bounds the side of a single variant
+const MaxVariantSize = 4096
+
+// VariantSpec describes one output of a variants run
+/* Size (int) - longest side in pixels; Format (string) - output format
+   MaxSize (int) - byte budget for this variant */
+type VariantSpec struct {
+	Size    int
+	Format  string
+	MaxSize int
+}
+
+// Variant is one encoded output of a variants run
+/* Spec (VariantSpec) - what was requested; Width, Height (int) - actual dimensions
+   Quality (int) - quality used for formats with a quality knob; Data ([]byte) - encoded image
+   Warnings ([]string) - notes such as upscaling a small source */
+type Variant struct {
+	Spec     VariantSpec
+	Width    int
+	Height   int
+	Quality  int
+	Data     []byte
+	Warnings []string
+}
+
+// Filename() - name the variant after base, its size and its format's extension, e.g. avatar-64.png
+// v (Variant) - variant to name
+func (v Variant) Filename(base string) string {
+	ext := ".img"
+	if enc, ok := LookupEncoder(v.Spec.Format); ok {
+		ext = enc.Extensions()[0]
+	}
+
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(base, filepath.Ext(base)), v.Spec.Size, ext)
+}
+
+// ParseVariants() - parse a comma-separated list of size[:format[:maxbytes]] entries
+/* spec (string) - variant list, empty or "default" for DefaultVariantSizes, maxbytes may use units such as 20KB
+   format (string) - format for entries that omit one; maxSize (int) - byte budget for entries that omit one */
+func ParseVariants(spec, format string, maxSize int) ([]VariantSpec, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "default" {
+		parts := make([]string, len(DefaultVariantSizes))
+		for i, size := range DefaultVariantSizes {
+			parts[i] = strconv.Itoa(size)
+		}
+		spec = strings.Join(parts, ",")
+	}
+
+	var specs []VariantSpec
+	for _, entry := range strings.Split(spec, ",") {
+		fields := strings.Split(strings.TrimSpace(entry), ":")
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("invalid variant %q: expected size[:format[:maxbytes]]", entry)
+		}
+
+		size, err := strconv.Atoi(fields[0])
+		if err != nil || size < 1 || size > MaxVariantSize {
+			return nil, fmt.Errorf("invalid variant %q: size must be between 1 and %d", entry, MaxVariantSize)
+		}
+
+		v := VariantSpec{Size: size, Format: format, MaxSize: maxSize}
+		if len(fields) > 1 && fields[1] != "" {
+			v.Format = fields[1]
+		}
+
+		enc, ok := LookupEncoder(v.Format)
+		if !ok {
+			return nil, fmt.Errorf("invalid variant %q: unsupported format %q", entry, v.Format)
+		}
+		v.Format = enc.Name()
+
+		if len(fields) > 2 {
+			size, err := ParseSize(fields[2])
+			if err != nil || size.Percent > 0 {
+				return nil, fmt.Errorf("invalid variant %q: maxbytes must be a size such as 4096 or 20KB", entry)
+			}
+			v.MaxSize = size.Bytes
+		}
+
+		specs = append(specs, v)
+	}
+
+	return specs, nil
+}
+
+// CompressVariants() - decode and crop the input once, then encode every variant at its exact size within its budget
+/* inputPath (string) - path of the input image; specs ([]VariantSpec) - variants to produce
+   opts (Options) - shared settings: crop, SVG size, the highest quality to use and verbose logging */
+func CompressVariants(inputPath string, specs []VariantSpec, opts Options) ([]Variant, error) {
+	for _, spec := range specs {
+		if err := CheckPadAlpha(opts.Crop, spec.Format); err != nil {
+			return nil, err
+		}
+	}
+
+	img, _, err := prepareSource(inputPath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	variants := make([]Variant, 0, len(specs))
+	for _, spec := range specs {
+		v, err := encodeVariant(img, spec, opts)
+		if err != nil {
+			return nil, fmt.Errorf("variant %dpx %s: %w", spec.Size, spec.Format, err)
+		}
+
+		if opts.Verbose {
+			fmt.Fprintf(LogOutput, "Variant %dx%d %s: %.2f KB (budget %.2f KB)\n",
+				v.Width, v.Height, spec.Format, float64(len(v.Data))/1024.0, float64(spec.MaxSize)/1024.0)
+		}
+
+		variants = append(variants, v)
+	}
+
+	return variants, nil
+}
+
+// encodeVariant() - resize img so its longest side is spec.Size and encode it, lowering quality until it fits spec.MaxSize
+/* img (image.Image) - prepared source; spec (VariantSpec) - variant to produce; opts (Options) - shared settings */
+func encodeVariant(img image.Image, spec VariantSpec, opts Options) (Variant, error) {
+	bounds := img.Bounds()
+	w, h := spec.Size, spec.Size
+	if bounds.Dx() > bounds.Dy() {
+		h = max(1, scaledHeight(bounds, w))
+	} else if bounds.Dy() > bounds.Dx() {
+		w = max(1, int(float64(bounds.Dx())*float64(h)/float64(bounds.Dy())+0.5))
+	}
+
+	v := Variant{Spec: spec, Width: w, Height: h}
+	if w > bounds.Dx() {
+		v.Warnings = append(v.Warnings, fmt.Sprintf("upscaled from %dx%d", bounds.Dx(), bounds.Dy()))
+	}
+
+	resized := imaging.Resize(img, w, h, imaging.Lanczos)
+
+	enc, ok := LookupEncoder(spec.Format)
+	if !ok {
+		return Variant{}, fmt.Errorf("unsupported format %q", spec.Format)
+	}
+
+	quality := opts.Quality
+	if quality < 1 || quality > 100 {
+		quality = qualityKnob.Default
+	}
+
+	if !HasKnob(enc, "quality") {
+		buf, err := encodeWith(resized, spec.Format, EncodeOptions{Quality: quality})
+		if err != nil {
+			return Variant{}, err
+		}
+
+		if buf.Len() > spec.MaxSize {
+			return Variant{}, &UnreachableError{Reason: fmt.Sprintf("%d bytes exceeds the budget of %d bytes", buf.Len(), spec.MaxSize)}
+		}
+
+		v.Data = buf.Bytes()
+		return v, nil
+	}
+
+	q, buf, err := highestQualityUnder(resized, spec.Format, quality, spec.MaxSize)
+	if err != nil {
+		return Variant{}, err
+	}
+
+	v.Quality, v.Data = q, buf.Bytes()
+	return v, nil
+}
+
+// highestQualityUnder() - binary search the highest quality up to maxQuality whose output fits budget
+/* img (image.Image) - image at its final size; format (string) - output format
+   maxQuality (int) - highest quality to try; budget (int) - byte budget */
+func highestQualityUnder(img image.Image, format string, maxQuality, budget int) (int, *bytes.Buffer, error) {
+	var best *bytes.Buffer
+	bestQuality := 0
+
+	low, high := 1, maxQuality
+	for low <= high {
+		mid := (low + high) / 2
+		buf, err := encodeWith(img, format, EncodeOptions{Quality: mid})
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if buf.Len() <= budget {
+			best, bestQuality = buf, mid
+			low = mid + 1
+		} else {
+			high = mid - 1
+		}
+	}
+
+	if best == nil {
+		return 0, nil, &UnreachableError{Reason: fmt.Sprintf("cannot fit the budget of %d bytes even at quality 1", budget)}
+	}
+
+	return bestQuality, best, nil
+}
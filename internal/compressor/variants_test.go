@@ -0,0 +1,84 @@
+package compressor
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestParseVariants() - test variant list parsing and defaults
+/* t (*testing.T) - testing object */
+func TestParseVariants(t *testing.T) {
+	specs, err := ParseVariants("", "jpeg", 1000)
+	if err != nil || len(specs) != len(DefaultVariantSizes) {
+		t.Fatalf("expected default sizes, got %v (%v)", specs, err)
+	}
+
+	specs, err = ParseVariants("32:png:4096, 64, 128:jpg", "jpeg", 1000)
+	if err != nil {
+		t.Fatalf("ParseVariants failed: %v", err)
+	}
+
+	want := []VariantSpec{{32, "png", 4096}, {64, "jpeg", 1000}, {128, "jpeg", 1000}}
+	for i, w := range want {
+		if specs[i] != w {
+			t.Errorf("variant %d: expected %+v, got %+v", i, w, specs[i])
+		}
+	}
+
+	for _, bad := range []string{"0", "abc", "32:bogus", "32:png:-1", "32:png:1:2", "99999"} {
+		if _, err := ParseVariants(bad, "jpeg", 1000); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+// TestCompressVariants() - test that every variant has its exact size and fits its budget
+/* t (*testing.T) - testing object */
+func TestCompressVariants(t *testing.T) {
+	inPath := filepath.Join(t.TempDir(), "in.png")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, makeNoiseImage(300, 200, 3)); err != nil {
+		t.Fatalf("png encode: %v", err)
+	}
+	os.WriteFile(inPath, buf.Bytes(), 0644)
+
+	specs := []VariantSpec{{32, "png", 64 * 1024}, {128, "jpeg", 6 * 1024}, {512, "jpeg", 200 * 1024}}
+	variants, err := CompressVariants(inPath, specs, Options{Quality: 90, Crop: CropSpec{Mode: CropCenter}})
+	if err != nil {
+		t.Fatalf("CompressVariants failed: %v", err)
+	}
+
+	for i, v := range variants {
+		if v.Width != specs[i].Size || v.Height != specs[i].Size {
+			t.Errorf("variant %d: expected %dpx square, got %dx%d", i, specs[i].Size, v.Width, v.Height)
+		}
+
+		if len(v.Data) > specs[i].MaxSize {
+			t.Errorf("variant %d: %d bytes exceeds budget %d", i, len(v.Data), specs[i].MaxSize)
+		}
+	}
+
+	if variants[1].Quality < 1 || variants[1].Quality > 90 {
+		t.Errorf("expected quality search within 1..90, got %d", variants[1].Quality)
+	}
+
+	if len(variants[2].Warnings) == 0 {
+		t.Error("expected an upscaling warning for the 512px variant of a 200px source")
+	}
+
+	if name := variants[0].Filename("me.jpg"); name != "me-32.png" {
+		t.Errorf("unexpected filename %s", name)
+	}
+
+	// a lossless variant that cannot fit is an error
+	var unreachable *UnreachableError
+	_, err = CompressVariants(inPath, []VariantSpec{{256, "png", 100}}, Options{})
+	if !errors.As(err, &unreachable) {
+		t.Errorf("expected UnreachableError, got %v", err)
+	}
+}
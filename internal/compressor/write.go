@@ -0,0 +1,92 @@
+package compressor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultFileMode is used for new output files; existing files keep their mode when replaced
+const defaultFileMode os.FileMode = 0644
+
+// WriteFileAtomic() - write data to path so readers only ever see the old or the complete new file
+/* path (string) - destination file; data ([]byte) - full file contents
+
+   The data goes to a temporary file in the same directory, is synced to disk, and is then
+   renamed over path. A crash mid-write leaves the original untouched. */
+func WriteFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	mode := defaultFileMode
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	// remove the temporary file on any failure before the rename
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+
+	if err := tmp.Chmod(mode); err != nil {
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	committed = true
+
+	syncDir(dir)
+	return nil
+}
+
+// BackupFile() - copy the file at path to path + ".bak", returns the backup path
+/* path (string) - file to back up */
+func BackupFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s for backup: %v", path, err)
+	}
+
+	backupPath := path + ".bak"
+	if err := WriteFileAtomic(backupPath, data); err != nil {
+		return "", fmt.Errorf("failed to write backup %s: %v", backupPath, err)
+	}
+
+	return backupPath, nil
+}
+
+// syncDir() - flush a directory entry so a completed rename survives a crash, best effort
+/* dir (string) - directory to sync */
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+
+	// not every platform supports syncing directories; the rename itself already succeeded
+	d.Sync()
+}
@@ -0,0 +1,81 @@
+package compressor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestWriteFileAtomic() - test that atomic writes replace the file, keep its mode and leave no temp files
+/* t (*testing.T) - testing object */
+func TestWriteFileAtomic(t *testing.T) {
+	td := t.TempDir()
+	path := filepath.Join(td, "out.jpg")
+
+	if err := WriteFileAtomic(path, []byte("first")); err != nil {
+		t.Fatalf("WriteFileAtomic failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	if info.Mode().Perm() != defaultFileMode {
+		t.Errorf("expected mode %v, got %v", defaultFileMode, info.Mode().Perm())
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+
+	if err := WriteFileAtomic(path, []byte("second")); err != nil {
+		t.Fatalf("WriteFileAtomic failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "second" {
+		t.Errorf("expected replaced contents, got %q", data)
+	}
+
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("expected existing mode to be kept, got %v", info.Mode().Perm())
+	}
+
+	entries, _ := os.ReadDir(td)
+	if len(entries) != 1 {
+		t.Errorf("expected only the output file in the directory, found %d entries", len(entries))
+	}
+}
+
+// TestWriteFileAtomic_MissingDir() - test that a failed write leaves nothing behind
+/* t (*testing.T) - testing object */
+func TestWriteFileAtomic_MissingDir(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "out.jpg")
+	if err := WriteFileAtomic(path, []byte("data")); err == nil {
+		t.Error("expected error for missing directory")
+	}
+}
+
+// TestBackupFile() - test that backups copy the original next to it
+/* t (*testing.T) - testing object */
+func TestBackupFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "avatar.png")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	backupPath, err := BackupFile(path)
+	if err != nil {
+		t.Fatalf("BackupFile failed: %v", err)
+	}
+
+	if backupPath != path+".bak" {
+		t.Errorf("unexpected backup path %s", backupPath)
+	}
+
+	data, _ := os.ReadFile(backupPath)
+	if string(data) != "original" {
+		t.Errorf("expected backup to hold the original, got %q", data)
+	}
+}
@@ -2,53 +2,52 @@ package gravatar
 
 import (
 	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/nabiladem/git-fit/internal/compressor"
 )
 
 // cropToSquare() - takes an image path and creates a square version by center-cropping, returns the path to the cropped image
 // imagePath (string) - path to the image to crop
 func cropToSquare(imagePath string) (string, error) {
+	return cropToSquareWith(imagePath, compressor.CropSpec{Mode: compressor.CropCenter})
+}
+
+// cropToSquareWith() - takes an image path and creates a square version using the given crop settings, returns the path to the cropped image
+/* imagePath (string) - path to the image to crop
+   spec (compressor.CropSpec) - crop settings, an empty mode falls back to center-cropping */
+func cropToSquareWith(imagePath string, spec compressor.CropSpec) (string, error) {
 	file, err := os.Open(imagePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to open image: %v", err)
 	}
 	defer file.Close()
 
-	img, format, err := image.Decode(file)
+	img, format, err := compressor.DecodeImage(file)
 	if err != nil {
 		return "", fmt.Errorf("failed to decode image: %v", err)
 	}
 
 	bounds := img.Bounds()
-	width := bounds.Dx()
-	height := bounds.Dy()
 
-	// if already square, return original path
-	if width == height {
+	// if already square and no explicit region was requested, return original path
+	if bounds.Dx() == bounds.Dy() && spec.Mode != compressor.CropManual {
 		return imagePath, nil
 	}
 
-	// determine square size (use smaller dimension)
-	size := width
-	if height < width {
-		size = height
+	if spec.Mode == compressor.CropNone {
+		spec.Mode = compressor.CropCenter
 	}
 
-	// calculate crop offsets to center the crop
-	xOffset := (width - size) / 2
-	yOffset := (height - size) / 2
+	if spec.Mode == compressor.CropManual && spec.Rect.Dx() != spec.Rect.Dy() {
+		return "", fmt.Errorf("crop region %v is not square", spec.Rect)
+	}
 
-	// create cropped image
-	cropped := image.NewRGBA(image.Rect(0, 0, size, size))
-	for y := 0; y < size; y++ {
-		for x := 0; x < size; x++ {
-			cropped.Set(x, y, img.At(x+xOffset, y+yOffset))
-		}
+	cropped, _, err := compressor.ApplyCrop(img, spec)
+	if err != nil {
+		return "", err
 	}
 
 	// create output path
@@ -62,17 +61,14 @@ func cropToSquare(imagePath string) (string, error) {
 	}
 	defer outFile.Close()
 
-	// encode based on format, 100 is used because the image is already compressed and Gravatar might already have compressed it
-	switch format {
-	case "jpeg", "jpg":
-		err = jpeg.Encode(outFile, cropped, &jpeg.Options{Quality: 100})
-	case "png":
-		err = png.Encode(outFile, cropped)
-	default:
-		err = jpeg.Encode(outFile, cropped, &jpeg.Options{Quality: 100})
+	// encode in the input format when possible, falling back to JPEG
+	enc, ok := compressor.LookupEncoder(format)
+	if !ok {
+		enc, _ = compressor.LookupEncoder("jpeg")
 	}
 
-	if err != nil {
+	// 100 is used because the image is already compressed and Gravatar might already have compressed it
+	if err := enc.Encode(outFile, cropped, compressor.EncodeOptions{Quality: 100}); err != nil {
 		return "", fmt.Errorf("failed to encode cropped image: %v", err)
 	}
 
@@ -8,6 +8,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/nabiladem/git-fit/internal/compressor"
 )
 
 // createTestImage() - creates a test image
@@ -88,3 +90,27 @@ func TestCropToSquare(t *testing.T) {
 		})
 	}
 }
+
+// TestCropToSquareWith_Manual() - tests cropToSquareWith with manual regions
+func TestCropToSquareWith_Manual(t *testing.T) {
+	tmpDir := t.TempDir()
+	filename := filepath.Join(tmpDir, "manual.png")
+	if err := createTestImage(filename, 80, 80, "png"); err != nil {
+		t.Fatalf("failed to create test image: %v", err)
+	}
+
+	// a manual region is applied even when the image is already square
+	croppedPath, err := cropToSquareWith(filename, compressor.CropSpec{Mode: compressor.CropManual, Rect: image.Rect(10, 10, 50, 50)})
+	if err != nil {
+		t.Fatalf("cropToSquareWith failed: %v", err)
+	}
+
+	if croppedPath == filename {
+		t.Fatalf("expected a new cropped file")
+	}
+
+	// non-square manual regions are rejected
+	if _, err := cropToSquareWith(filename, compressor.CropSpec{Mode: compressor.CropManual, Rect: image.Rect(0, 0, 40, 20)}); err == nil {
+		t.Error("expected error for non-square region")
+	}
+}
@@ -9,17 +9,21 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+
+	"github.com/nabiladem/git-fit/internal/compressor"
 )
 
 var apiBaseURL = "https://api.gravatar.com/v3"
 
 // Client handles Gravatar REST API interactions with OAuth
+// Crop selects how non-square images are made square before upload (center by default)
 type Client struct {
 	ClientID     string
 	ClientSecret string
 	RedirectURI  string
 	AccessToken  string
 	Verbose      bool
+	Crop         compressor.CropSpec
 }
 
 // NewClient() - creates a new Gravatar client with OAuth credentials
@@ -63,7 +67,7 @@ func (c *Client) UploadAvatar(imagePath string) error {
 		fmt.Println("Checking if image needs to be cropped to square...")
 	}
 
-	squareImagePath, err := cropToSquare(imagePath)
+	squareImagePath, err := cropToSquareWith(imagePath, c.Crop)
 	if err != nil {
 		return fmt.Errorf("failed to crop image to square: %v", err)
 	}
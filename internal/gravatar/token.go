@@ -0,0 +1,115 @@
+package gravatar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// userConfigDir is swapped out by tests so they never touch the real config directory
+var userConfigDir = os.UserConfigDir
+
+// ErrNoToken reports that no access token has been saved yet
+var ErrNoToken = errors.New("not logged in to Gravatar - run 'gitfit auth login' first")
+
+// StoredToken is the access token saved by `gitfit auth login`
+/* AccessToken (string) - OAuth bearer token; SavedAt (time.Time) - when the token was obtained */
+type StoredToken struct {
+	AccessToken string    `json:"access_token"`
+	SavedAt     time.Time `json:"saved_at"`
+}
+
+// TokenPath() - path of the saved token file inside the user's config directory
+func TokenPath() (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate config directory: %v", err)
+	}
+
+	return filepath.Join(dir, "gitfit", "gravatar-token.json"), nil
+}
+
+// SaveToken() - save an access token readable only by the current user
+/* token (string) - OAuth access token */
+func SaveToken(token string) error {
+	path, err := TokenPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(StoredToken{AccessToken: token, SavedAt: time.Now().UTC()}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a private temp file first so the token is never world-readable, even briefly
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".gravatar-token-*")
+	if err != nil {
+		return fmt.Errorf("failed to save token: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save token: %v", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save token: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save token: %v", err)
+	}
+
+	return nil
+}
+
+// LoadToken() - read the saved access token, ErrNoToken when there is none
+func LoadToken() (*StoredToken, error) {
+	path, err := TokenPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoToken
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read token: %v", err)
+	}
+
+	var token StoredToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	if token.AccessToken == "" {
+		return nil, ErrNoToken
+	}
+
+	return &token, nil
+}
+
+// DeleteToken() - forget the saved access token, returns whether there was one
+func DeleteToken() (bool, error) {
+	path, err := TokenPath()
+	if err != nil {
+		return false, err
+	}
+
+	if err := os.Remove(path); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to remove token: %v", err)
+	}
+
+	return true, nil
+}
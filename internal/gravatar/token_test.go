@@ -0,0 +1,45 @@
+package gravatar
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// TestTokenStore() - test saving, loading and deleting the access token
+func TestTokenStore(t *testing.T) {
+	dir := t.TempDir()
+	userConfigDir = func() (string, error) { return dir, nil }
+	defer func() { userConfigDir = os.UserConfigDir }()
+
+	if _, err := LoadToken(); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("expected ErrNoToken before login, got %v", err)
+	}
+
+	if err := SaveToken("abc123"); err != nil {
+		t.Fatalf("SaveToken failed: %v", err)
+	}
+
+	path, _ := TokenPath()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("token file missing: %v", err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected token file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	token, err := LoadToken()
+	if err != nil || token.AccessToken != "abc123" || token.SavedAt.IsZero() {
+		t.Errorf("unexpected token %+v (%v)", token, err)
+	}
+
+	if removed, err := DeleteToken(); !removed || err != nil {
+		t.Errorf("expected token to be removed, got %v (%v)", removed, err)
+	}
+
+	if removed, err := DeleteToken(); removed || err != nil {
+		t.Errorf("expected nothing to remove, got %v (%v)", removed, err)
+	}
+}
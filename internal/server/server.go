@@ -0,0 +1,756 @@
+// Package server implements the git-fit HTTP API used by the web app, `gitfit serve` and cmd/server
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+	"github.com/nabiladem/git-fit/internal/compressor"
+)
+
+// maxSVGSize bounds the 'svg_size' field; the CLI allows up to compressor.MaxSVGSize,
+// but a public endpoint should not rasterize hundreds of megabytes per request
+const maxSVGSize = compressor.DefaultSVGSize
+
+// storedFile struct holds data for a compressed file
+/* Data ([]byte) - file data; Mime (string) - MIME type of the file
+   Filename (string) - original filename; Expires (time.Time) - expiration time
+   Token (string) - access token for download authorization */
+type storedFile struct {
+	Data     []byte
+	Mime     string
+	Filename string
+	Expires  time.Time
+	Token    string
+}
+
+// global file store
+var (
+	fileStore = struct {
+		sync.Mutex
+		m map[string]storedFile
+	}{m: make(map[string]storedFile)}
+
+	janitorOnce sync.Once
+)
+
+// startJanitor() - start the goroutine that cleans up expired files, once per process
+func startJanitor() {
+	janitorOnce.Do(func() { go janitor() })
+}
+
+// janitor() - remove expired files from the store every minute
+func janitor() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		fileStore.Lock()
+		for k, v := range fileStore.m {
+			if v.Expires.Before(now) {
+				delete(fileStore.m, k)
+			}
+		}
+		fileStore.Unlock()
+	}
+}
+
+// NewRouter() - initialize router with middleware and routes, returning new router instance
+func NewRouter() *gin.Engine {
+	startJanitor()
+
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:5173"
+	}
+
+	startTime := time.Now() // track uptime
+
+	// new Gin router with no default middleware
+	r := gin.New()
+
+	// add logging and recovery middleware
+	r.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		// custom log format: [TIME] STATUS METHOD PATH (LATENCY)
+		return fmt.Sprintf("[%s] %d | %13v | %s | %s %s\n",
+			param.TimeStamp.Format("2006-01-02 15:04:05"),
+			param.StatusCode,
+			param.Latency,
+			param.ClientIP,
+			param.Method,
+			param.Path,
+		)
+	}))
+	r.Use(gin.Recovery())
+
+	// enable CORS (for local dev with Vite frontend)
+	r.Use(cors.New(cors.Config{
+		AllowOrigins:     []string{frontendURL},
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowCredentials: true,
+	}))
+
+	// GET /api/health
+	// simple health check for uptime and status
+	r.GET("/api/health", func(c *gin.Context) {
+		uptime := time.Since(startTime).Truncate(time.Second)
+		c.JSON(http.StatusOK, gin.H{
+			"status":    "ok",
+			"uptime":    uptime.String(),
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+	})
+
+	// GET /api/formats
+	// lists the registered output formats and their capabilities
+	r.GET("/api/formats", func(c *gin.Context) {
+		formats := []gin.H{}
+		for _, enc := range compressor.Encoders() {
+			knobs := enc.Knobs()
+			if knobs == nil {
+				knobs = []compressor.Knob{}
+			}
+
+			formats = append(formats, gin.H{
+				"name":       enc.Name(),
+				"extensions": enc.Extensions(),
+				"mime":       enc.MIMEType(),
+				"alpha":      enc.SupportsAlpha(),
+				"animation":  enc.SupportsAnimation(),
+				"knobs":      knobs,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"formats": formats})
+	})
+
+	// POST /api/compress
+	// sends a compressed image file in response
+	// returns JSON with download URL
+	r.POST("/api/compress", func(c *gin.Context) {
+		tmpPath, ok := receiveUpload(c)
+		if !ok {
+			return
+		}
+		defer os.Remove(tmpPath)
+
+		opts, ok := parseOptions(c)
+		if !ok {
+			return
+		}
+
+		if err := compressor.CheckPadAlpha(opts.Crop, opts.OutputFormat); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'pad' field", "detail": err.Error()})
+			return
+		}
+
+		// the response always reports the safe zone of the avatar
+		opts.SafeZone = true
+		crop := opts.Crop
+		enc, _ := compressor.LookupEncoder(opts.OutputFormat)
+
+		// estimate mode runs the search and returns the plan without writing or storing anything
+		if c.PostForm("estimate") == "true" {
+			plan := opts
+			plan.DryRun = true
+			result, err := compressor.Compress(tmpPath, "", plan)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "estimate failed", "detail": err.Error()})
+				return
+			}
+
+			resp := gin.H{
+				"estimate":       true,
+				"reachable":      result.Reachable,
+				"format":         result.Format,
+				"width":          result.Width,
+				"height":         result.Height,
+				"quality":        result.Quality,
+				"projected_size": result.Size,
+				"ssim":           result.SSIM,
+				"psnr":           result.PSNR,
+				"warnings":       result.Warnings,
+			}
+			addPlaceholder(resp, result)
+
+			c.JSON(http.StatusOK, resp)
+			return
+		}
+
+		// determine output extension
+		outExt := enc.Extensions()[0]
+
+		// create output temp file
+		outTmp, err := os.CreateTemp("", "gitfit-compressed-*"+outExt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create output temp file"})
+			return
+		}
+
+		outPath := outTmp.Name()
+		outTmp.Close()
+
+		// run compression
+		result, err := compressor.Compress(tmpPath, outPath, opts)
+		if err != nil {
+			_ = os.Remove(outPath)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "compression failed", "detail": err.Error()})
+			return
+		}
+
+		// get output file info
+		info, err := os.Stat(outPath)
+		if err != nil {
+			_ = os.Remove(outPath)
+			_ = os.Remove(tmpPath)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stat compressed file"})
+			return
+		}
+
+		mimeType := enc.MIMEType()
+
+		data, err := os.ReadFile(outPath)
+		if err != nil {
+			_ = os.Remove(outPath)
+			_ = os.Remove(tmpPath)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read compressed file"})
+			return
+		}
+
+		// store in memory (expires in 5 min)
+		id, token := storeFile(data, mimeType, filepath.Base(outPath))
+
+		// cleanup temp files
+		_ = os.Remove(outPath)
+		_ = os.Remove(tmpPath)
+
+		downloadURL := buildDownloadURL(c, id, token)
+
+		resp := gin.H{
+			"filename":     filepath.Base(outPath),
+			"size":         info.Size(),
+			"mime":         mimeType,
+			"format":       result.Format,
+			"width":        result.Width,
+			"height":       result.Height,
+			"quality":      result.Quality,
+			"ssim":         result.SSIM,
+			"psnr":         result.PSNR,
+			"message":      "compression successful",
+			"download_url": downloadURL,
+			"expires_in":   300,
+		}
+
+		if crop.Mode != compressor.CropNone || crop.Focus != nil {
+			resp["crop"] = rectJSON(result.CropRect)
+		}
+
+		resp["safe_zone"] = gin.H{
+			"outside_ratio": result.SafeZone.OutsideRatio,
+			"outside_area":  result.SafeZone.OutsideArea,
+			"clipped":       result.SafeZone.Clipped,
+		}
+
+		addPlaceholder(resp, result)
+
+		if len(result.Warnings) > 0 {
+			resp["warnings"] = result.Warnings
+		}
+
+		// optional PNG preview of the output under a circular avatar mask
+		if c.PostForm("preview") == "true" {
+			img, _, err := compressor.DecodeImage(bytes.NewReader(data))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode compressed file for preview"})
+				return
+			}
+
+			var preview bytes.Buffer
+			if err := png.Encode(&preview, compressor.CirclePreview(img)); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode preview"})
+				return
+			}
+
+			pid, ptoken := storeFile(preview.Bytes(), "image/png", "circle-preview.png")
+			resp["preview_url"] = buildDownloadURL(c, pid, ptoken)
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// POST /api/variants
+	// compresses the upload into several sizes at once
+	// returns JSON with a download URL per variant and one for a zip of all of them, or the zip itself with archive=zip
+	r.POST("/api/variants", func(c *gin.Context) {
+		tmpPath, ok := receiveUpload(c)
+		if !ok {
+			return
+		}
+		defer os.Remove(tmpPath)
+
+		opts, ok := parseOptions(c)
+		if !ok {
+			return
+		}
+
+		specs, err := compressor.ParseVariants(c.PostForm("variants"), opts.OutputFormat, opts.MaxSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'variants' field", "detail": err.Error()})
+			return
+		}
+
+		for _, spec := range specs {
+			if err := compressor.CheckPadAlpha(opts.Crop, spec.Format); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'pad' field", "detail": err.Error()})
+				return
+			}
+		}
+
+		variants, err := compressor.CompressVariants(tmpPath, specs, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "compression failed", "detail": err.Error()})
+			return
+		}
+
+		entries := make([]zipEntry, len(variants))
+		for i, v := range variants {
+			entries[i] = zipEntry{Name: v.Filename("avatar"), Data: v.Data}
+		}
+
+		archive, err := zipFiles(entries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build zip"})
+			return
+		}
+
+		if c.PostForm("archive") == "zip" {
+			c.Header("Content-Disposition", "attachment; filename="+strconv.Quote("avatar-variants.zip"))
+			c.Data(http.StatusOK, "application/zip", archive)
+			return
+		}
+
+		items := make([]gin.H, 0, len(variants))
+		for _, v := range variants {
+			enc, _ := compressor.LookupEncoder(v.Spec.Format)
+			id, token := storeFile(v.Data, enc.MIMEType(), v.Filename("avatar"))
+
+			item := gin.H{
+				"filename":     v.Filename("avatar"),
+				"format":       v.Spec.Format,
+				"width":        v.Width,
+				"height":       v.Height,
+				"size":         len(v.Data),
+				"max_size":     v.Spec.MaxSize,
+				"mime":         enc.MIMEType(),
+				"download_url": buildDownloadURL(c, id, token),
+			}
+
+			if v.Quality > 0 {
+				item["quality"] = v.Quality
+			}
+
+			if len(v.Warnings) > 0 {
+				item["warnings"] = v.Warnings
+			}
+
+			items = append(items, item)
+		}
+
+		zid, ztoken := storeFile(archive, "application/zip", "avatar-variants.zip")
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":    "compression successful",
+			"variants":   items,
+			"zip_url":    buildDownloadURL(c, zid, ztoken),
+			"expires_in": 300,
+		})
+	})
+
+	// POST /api/srcset
+	// compresses the upload into a width ladder for responsive images
+	// returns JSON with a download URL per image, a zip of all of them, and HTML and Markdown snippets, or the zip itself with archive=zip
+	r.POST("/api/srcset", func(c *gin.Context) {
+		tmpPath, ok := receiveUpload(c)
+		if !ok {
+			return
+		}
+		defer os.Remove(tmpPath)
+
+		opts, ok := parseOptions(c)
+		if !ok {
+			return
+		}
+
+		widths, err := compressor.ParseWidths(c.PostForm("widths"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'widths' field", "detail": err.Error()})
+			return
+		}
+
+		formats, err := compressor.ParseFormats(c.PostForm("formats"), opts.OutputFormat)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'formats' field", "detail": err.Error()})
+			return
+		}
+
+		if err := compressor.CheckPadAlpha(opts.Crop, formats...); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'pad' field", "detail": err.Error()})
+			return
+		}
+
+		set, err := compressor.CompressSrcset(tmpPath, widths, formats, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "compression failed", "detail": err.Error()})
+			return
+		}
+
+		// name files after the upload so the snippet matches what the user saves
+		base := "image"
+		if file, err := c.FormFile("avatar"); err == nil && file.Filename != "" {
+			base = filepath.Base(file.Filename)
+		}
+
+		entries := make([]zipEntry, len(set.Images))
+		for i, img := range set.Images {
+			entries[i] = zipEntry{Name: img.Filename(base), Data: img.Data}
+		}
+
+		archive, err := zipFiles(entries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build zip"})
+			return
+		}
+
+		if c.PostForm("archive") == "zip" {
+			c.Header("Content-Disposition", "attachment; filename="+strconv.Quote("srcset.zip"))
+			c.Data(http.StatusOK, "application/zip", archive)
+			return
+		}
+
+		items := make([]gin.H, 0, len(set.Images))
+		for _, img := range set.Images {
+			enc, _ := compressor.LookupEncoder(img.Format)
+			id, token := storeFile(img.Data, enc.MIMEType(), img.Filename(base))
+
+			items = append(items, gin.H{
+				"filename":     img.Filename(base),
+				"format":       img.Format,
+				"width":        img.Width,
+				"height":       img.Height,
+				"size":         len(img.Data),
+				"mime":         enc.MIMEType(),
+				"download_url": buildDownloadURL(c, id, token),
+			})
+		}
+
+		zid, ztoken := storeFile(archive, "application/zip", "srcset.zip")
+		prefix, alt := c.PostForm("url_prefix"), c.PostForm("alt")
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":    "compression successful",
+			"images":     items,
+			"html":       set.HTML(base, prefix, alt),
+			"markdown":   set.Markdown(base, prefix, alt),
+			"zip_url":    buildDownloadURL(c, zid, ztoken),
+			"expires_in": 300,
+		})
+	})
+
+	// GET /api/download/:id
+	// serves the compressed file if token is valid
+	r.GET("/api/download/:id", func(c *gin.Context) {
+		id := c.Param("id")
+		token := c.Query("token")
+
+		// lookup file
+		fileStore.Lock()
+		f, ok := fileStore.m[id]
+		fileStore.Unlock()
+
+		if !ok || time.Now().After(f.Expires) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found or expired"})
+			return
+		}
+
+		// validate token
+		if subtle.ConstantTimeCompare([]byte(token), []byte(f.Token)) != 1 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "invalid token"})
+			return
+		}
+
+		c.Header("Content-Type", f.Mime)
+		c.Header("Content-Disposition", "attachment; filename="+strconv.Quote(f.Filename))
+		c.Data(http.StatusOK, f.Mime, f.Data)
+	})
+
+	// serve static frontend files
+	r.Static("/assets", "./web/dist/assets")
+
+	// handle unknown API routes with JSON 404
+	r.NoRoute(func(c *gin.Context) {
+		if len(c.Request.URL.Path) >= 5 && c.Request.URL.Path[:5] == "/api/" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "not found",
+				"message": "API endpoint does not exist",
+			})
+			return
+		}
+
+		// otherwise, serve React index.html (for client-side routing)
+		c.File("./web/dist/index.html")
+	})
+
+	return r
+}
+
+// receiveUpload() - save the 'avatar' upload to a temp file, returns its path and whether it succeeded
+/* c (*gin.Context) - request context, an error response is written on failure */
+func receiveUpload(c *gin.Context) (string, bool) {
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing 'avatar' file field"})
+		return "", false
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to open uploaded file"})
+		return "", false
+	}
+	defer src.Close()
+
+	// create temp file to store upload
+	ext := filepath.Ext(file.Filename)
+	tmp, err := os.CreateTemp("", "gitfit-*-upload"+ext)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create temp file"})
+		return "", false
+	}
+	defer tmp.Close()
+
+	// copy uploaded content to temp file
+	if _, err := io.Copy(tmp, src); err != nil {
+		os.Remove(tmp.Name())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save uploaded file"})
+		return "", false
+	}
+
+	return tmp.Name(), true
+}
+
+// parseOptions() - read the compression form fields shared by the endpoints, returns the options and whether they were valid
+/* c (*gin.Context) - request context, a 400 response is written for invalid fields */
+func parseOptions(c *gin.Context) (compressor.Options, bool) {
+	// optional form params: maxsize, format, quality
+	maxSize := 1048576 // default 1MiB
+	if v := c.PostForm("maxsize"); v != "" {
+		size, err := compressor.ParseSize(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'maxsize' field", "detail": err.Error()})
+			return compressor.Options{}, false
+		}
+
+		// a percentage is a share of the uploaded file
+		var uploadSize int64
+		if file, err := c.FormFile("avatar"); err == nil {
+			uploadSize = file.Size
+		}
+		maxSize = size.Resolve(uploadSize)
+	}
+
+	format := c.PostForm("format")
+	if format == "" {
+		format = "jpeg"
+	}
+
+	enc, ok := compressor.LookupEncoder(format)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported 'format' field", "formats": compressor.FormatNames()})
+		return compressor.Options{}, false
+	}
+
+	quality := 85
+	if q := c.PostForm("quality"); q != "" {
+		if n, err := strconv.Atoi(q); err == nil && n >= 1 && n <= 100 {
+			quality = n
+		}
+	}
+
+	crop, err := compressor.ParseCrop(c.PostForm("crop"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'crop' field", "detail": err.Error()})
+		return compressor.Options{}, false
+	}
+
+	crop.Focus, err = compressor.ParseFocus(c.PostForm("focus"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'focus' field", "detail": err.Error()})
+		return compressor.Options{}, false
+	}
+
+	if v := c.PostForm("pad"); v != "" {
+		// padding keeps the whole image, so there is no square to place
+		if c.PostForm("crop") != "" || c.PostForm("focus") != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "'pad' cannot be combined with 'crop' or 'focus'"})
+			return compressor.Options{}, false
+		}
+
+		bg, err := compressor.ParsePadBackground(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'pad' field", "detail": err.Error()})
+			return compressor.Options{}, false
+		}
+		crop = compressor.CropSpec{Mode: compressor.CropPad, Pad: bg}
+	}
+
+	minSSIM := 0.0
+	if v := c.PostForm("min_ssim"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n < 0 || n > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'min_ssim' field, must be between 0 and 1"})
+			return compressor.Options{}, false
+		}
+		minSSIM = n
+	}
+
+	svgSize := 0
+	if v := c.PostForm("svg_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSVGSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid 'svg_size' field, must be between 1 and %d", maxSVGSize)})
+			return compressor.Options{}, false
+		}
+		svgSize = n
+	}
+
+	return compressor.Options{
+		MaxSize:      maxSize,
+		OutputFormat: enc.Name(),
+		Quality:      quality,
+		Crop:         crop,
+		MinSSIM:      minSSIM,
+		SVGSize:      svgSize,
+		Placeholder:  c.PostForm("placeholder") == "true",
+	}, true
+}
+
+// addPlaceholder() - add the BlurHash and ThumbHash of a result to a response when they were requested
+/* resp (gin.H) - response being built; result (*compressor.Result) - compression result */
+func addPlaceholder(resp gin.H, result *compressor.Result) {
+	if result.Placeholder == nil {
+		return
+	}
+
+	resp["blurhash"] = result.Placeholder.BlurHash
+	resp["thumbhash"] = result.Placeholder.ThumbHash
+}
+
+// zipEntry is one file of a zip archive built in memory
+/* Name (string) - file name inside the archive; Data ([]byte) - file contents */
+type zipEntry struct {
+	Name string
+	Data []byte
+}
+
+// zipFiles() - pack files into a zip archive
+/* entries ([]zipEntry) - files to pack, in order */
+func zipFiles(entries []zipEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, e := range entries {
+		// images are already compressed, so store them as is
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.Name, Method: zip.Store, Modified: time.Now()})
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := w.Write(e.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// storeFile() - keep data in the in-memory file store for five minutes, returns its id and access token
+/* data ([]byte) - file data; mimeType (string) - MIME type of the file; filename (string) - download filename */
+func storeFile(data []byte, mimeType, filename string) (string, string) {
+	// generate short-lived id + token
+	idb := make([]byte, 16)
+	_, _ = rand.Read(idb)
+	id := hex.EncodeToString(idb)
+	tokn := make([]byte, 16)
+	_, _ = rand.Read(tokn)
+	token := hex.EncodeToString(tokn)
+
+	fileStore.Lock()
+	fileStore.m[id] = storedFile{
+		Data:     data,
+		Mime:     mimeType,
+		Filename: filename,
+		Expires:  time.Now().Add(5 * time.Minute),
+		Token:    token,
+	}
+	fileStore.Unlock()
+
+	return id, token
+}
+
+// buildDownloadURL() - build an absolute download URL for a stored file
+/* c (*gin.Context) - request context; id (string) - file id; token (string) - access token */
+func buildDownloadURL(c *gin.Context, id, token string) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	host := c.Request.Host
+	return fmt.Sprintf("%s://%s/api/download/%s?token=%s", scheme, host, id, token)
+}
+
+// rectJSON() - convert a rectangle into a JSON-friendly map
+/* r (image.Rectangle) - rectangle to convert */
+func rectJSON(r image.Rectangle) gin.H {
+	return gin.H{"x": r.Min.X, "y": r.Min.Y, "width": r.Dx(), "height": r.Dy()}
+}
+
+// Run() - load .env if present and serve the API until the server fails
+/* port (string) - port to listen on, $PORT or 8080 when empty */
+func Run(port string) error {
+	_ = godotenv.Load()
+
+	if port == "" {
+		port = os.Getenv("PORT")
+	}
+	if port == "" {
+		port = "8080"
+	}
+
+	r := NewRouter()
+
+	addr := ":" + port
+	fmt.Println("Server running on", addr)
+	return r.Run(addr)
+}
@@ -0,0 +1,769 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createTestImage() - create an image for testing, returns image data and error
+func createTestImage() ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 100; y++ {
+			img.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// TestHealthCheck() - test health check endpoint
+func TestHealthCheck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	// send request
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/health", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var resp map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	if resp["status"] != "ok" {
+		t.Errorf("Expected status 'ok', got '%s'", resp["status"])
+	}
+}
+
+// TestCompressEndpoint() - test compress endpoint
+func TestCompressEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	// create a test image
+	imgData, err := createTestImage()
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	// create multipart form
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("avatar", "test.png")
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+
+	if _, err := part.Write(imgData); err != nil {
+		t.Fatalf("Failed to write image data: %v", err)
+	}
+	writer.Close()
+
+	// send request
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/compress", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	// parse response
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	if _, ok := resp["download_url"]; !ok {
+		t.Error("Response missing 'download_url'")
+	}
+
+	if _, ok := resp["ssim"].(float64); !ok {
+		t.Error("Response missing 'ssim'")
+	}
+
+	if _, ok := resp["psnr"].(float64); !ok {
+		t.Error("Response missing 'psnr'")
+	}
+}
+
+// TestCompressEndpointMissingFile() - test compress endpoint with missing file
+func TestCompressEndpointMissingFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	// send request
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/compress", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+// TestDownloadEndpoint() - test download endpoint
+func TestDownloadEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	// manually inject a file into the store
+	id := "test-id"
+	token := "test-token"
+
+	fileStore.Lock()
+	fileStore.m[id] = storedFile{
+		Data:     []byte("fake image data"),
+		Mime:     "image/png",
+		Filename: "test.png",
+		Expires:  time.Now().Add(time.Minute),
+		Token:    token,
+	}
+	fileStore.Unlock()
+
+	// test valid download
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/download/"+id+"?token="+token, nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	if w.Body.String() != "fake image data" {
+		t.Errorf("Expected body 'fake image data', got '%s'", w.Body.String())
+	}
+
+	// test invalid token
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/download/"+id+"?token=wrong", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+
+	// test missing file
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/download/missing?token="+token, nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+// TestNotFound() - test not found endpoint
+func TestNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/unknown", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+// TestCompressEndpoint_InvalidFormat() - test compress endpoint with invalid format
+func TestCompressEndpoint_InvalidFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	// create multipart form with invalid parameters
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	
+	// add a dummy file
+	part, _ := writer.CreateFormFile("avatar", "test.png")
+	part.Write([]byte("fake image data"))
+	
+	// add invalid quality parameter
+	writer.WriteField("quality", "200")
+	writer.Close()
+
+	// send request
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/compress", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	r.ServeHTTP(w, req)
+
+	// should still process (clamped to valid range)
+	if w.Code == http.StatusOK {
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+	}
+}
+
+// TestDownloadEndpoint_Expired() - test download endpoint with expired file
+func TestDownloadEndpoint_Expired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	// manually inject an expired file into the store
+	id := "expired-id"
+	token := "expired-token"
+	fileStore.Lock()
+	fileStore.m[id] = storedFile{
+		Data:     []byte("expired data"),
+		Mime:     "image/png",
+		Filename: "expired.png",
+		Expires:  time.Now().Add(-time.Minute), // expired 1 minute ago
+		Token:    token,
+	}
+	fileStore.Unlock()
+
+	// send request
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/download/"+id+"?token="+token, nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for expired file, got %d", w.Code)
+	}
+}
+
+// TestCompressEndpoint_Crop() - test compress endpoint with crop parameters
+func TestCompressEndpoint_Crop(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	imgData, err := createTestImage()
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	// send a request with the given field name and value pairs and return the recorder
+	send := func(fields ...string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("avatar", "test.png")
+		part.Write(imgData)
+		for i := 0; i+1 < len(fields); i += 2 {
+			writer.WriteField(fields[i], fields[i+1])
+		}
+		// the first value of a field wins, so a format given above overrides this one
+		writer.WriteField("format", "png")
+		writer.Close()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/compress", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("crop", "10,10,50,50")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	if resp["width"] != float64(50) || resp["height"] != float64(50) {
+		t.Errorf("Expected 50x50 output, got %vx%v", resp["width"], resp["height"])
+	}
+
+	if _, ok := resp["crop"]; !ok {
+		t.Error("Response missing 'crop'")
+	}
+
+	// invalid crop is rejected
+	if w := send("crop", "bogus"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid crop, got %d", w.Code)
+	}
+
+	// pad keeps the whole image, so it cannot be combined with crop or focus
+	if w := send("pad", "white"); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for pad, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	for _, field := range []string{"crop", "focus"} {
+		value := map[string]string{"crop": "center", "focus": "0.5,0.5"}[field]
+		if w := send("pad", "white", field, value); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for pad with %s, got %d", field, w.Code)
+		}
+	}
+
+	// a transparent letterbox needs a format with alpha
+	if w := send("pad", "transparent", "format", "jpeg"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for transparent pad as jpeg, got %d", w.Code)
+	}
+
+	if w := send("pad", "transparent"); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for transparent pad as png, got %d. Body: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestCompressEndpoint_SafeZonePreview() - test safe zone report and circle preview in the compress response
+func TestCompressEndpoint_SafeZonePreview(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	imgData, err := createTestImage()
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("avatar", "test.png")
+	part.Write(imgData)
+	writer.WriteField("preview", "true")
+	writer.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/compress", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	if _, ok := resp["safe_zone"].(map[string]interface{}); !ok {
+		t.Error("Response missing 'safe_zone'")
+	}
+
+	if _, ok := resp["preview_url"].(string); !ok {
+		t.Error("Response missing 'preview_url'")
+	}
+}
+
+// TestCompressEndpoint_Estimate() - test that estimate mode returns a plan and stores nothing
+func TestCompressEndpoint_Estimate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	imgData, err := createTestImage()
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("avatar", "test.png")
+	part.Write(imgData)
+	writer.WriteField("estimate", "true")
+	writer.Close()
+
+	fileStore.Lock()
+	before := len(fileStore.m)
+	fileStore.Unlock()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/compress", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	if resp["reachable"] != true {
+		t.Errorf("Expected reachable plan, got %v", resp["reachable"])
+	}
+
+	if _, ok := resp["download_url"]; ok {
+		t.Error("Estimate must not return a download URL")
+	}
+
+	fileStore.Lock()
+	after := len(fileStore.m)
+	fileStore.Unlock()
+
+	if after != before {
+		t.Errorf("Estimate must not store files, store grew from %d to %d", before, after)
+	}
+}
+
+// TestFormatsEndpoint() - test that the registered output formats are listed
+func TestFormatsEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/formats", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var resp struct {
+		Formats []struct {
+			Name  string `json:"name"`
+			Mime  string `json:"mime"`
+			Alpha bool   `json:"alpha"`
+			Knobs []struct {
+				Name string `json:"name"`
+			} `json:"knobs"`
+		} `json:"formats"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	found := map[string]bool{}
+	for _, f := range resp.Formats {
+		found[f.Name] = true
+		if f.Name == "jpeg" && (f.Mime != "image/jpeg" || f.Alpha || len(f.Knobs) == 0) {
+			t.Errorf("Unexpected jpeg entry: %+v", f)
+		}
+	}
+
+	for _, name := range []string{"jpeg", "png", "gif"} {
+		if !found[name] {
+			t.Errorf("Expected format %s to be listed", name)
+		}
+	}
+}
+
+// TestCompressEndpoint_UnknownFormat() - test that unregistered output formats are rejected
+func TestCompressEndpoint_UnknownFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	imgData, err := createTestImage()
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("avatar", "test.png")
+	part.Write(imgData)
+	writer.WriteField("format", "tiff2")
+	writer.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/compress", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+// TestCompressEndpoint_SVG() - test that SVG uploads are rasterized at the requested size
+func TestCompressEndpoint_SVG(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><circle cx="5" cy="5" r="4" fill="#0a0"/></svg>`
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("avatar", "logo.svg")
+	part.Write([]byte(svg))
+	writer.WriteField("format", "png")
+	writer.WriteField("svg_size", "256")
+	writer.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/compress", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	if resp["width"] != float64(256) || resp["height"] != float64(256) {
+		t.Errorf("Expected 256x256 output, got %vx%v", resp["width"], resp["height"])
+	}
+
+	// sizes the CLI accepts can still be too costly for the server
+	for _, size := range []string{"0", "2049", "8192"} {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("avatar", "logo.svg")
+		part.Write([]byte(svg))
+		writer.WriteField("format", "png")
+		writer.WriteField("svg_size", size)
+		writer.Close()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/compress", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("svg_size %s: expected status 400, got %d", size, w.Code)
+		}
+	}
+}
+
+// TestCompressEndpoint_ICO() - test that icons can be requested as an output format
+func TestCompressEndpoint_ICO(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	imgData, err := createTestImage()
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("avatar", "test.png")
+	part.Write(imgData)
+	writer.WriteField("format", "ico")
+	writer.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/compress", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	if resp["mime"] != "image/x-icon" || resp["format"] != "ico" {
+		t.Errorf("Expected ico output, got format %v mime %v", resp["format"], resp["mime"])
+	}
+
+	if filename, _ := resp["filename"].(string); !strings.HasSuffix(filename, ".ico") {
+		t.Errorf("Expected .ico filename, got %v", resp["filename"])
+	}
+}
+
+// TestVariantsEndpoint() - test that every requested size gets a download URL and the zip holds them all
+func TestVariantsEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	imgData, err := createTestImage()
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	post := func(fields map[string]string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("avatar", "test.png")
+		part.Write(imgData)
+		for k, v := range fields {
+			writer.WriteField(k, v)
+		}
+		writer.Close()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/variants", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(map[string]string{"variants": "32,64:png"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Variants []struct {
+			Width       int    `json:"width"`
+			Format      string `json:"format"`
+			DownloadURL string `json:"download_url"`
+		} `json:"variants"`
+		ZipURL string `json:"zip_url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	if len(resp.Variants) != 2 || resp.Variants[0].Width != 32 || resp.Variants[1].Format != "png" || resp.ZipURL == "" {
+		t.Errorf("Unexpected variants response: %+v", resp)
+	}
+
+	w = post(map[string]string{"variants": "32,64", "archive": "zip"})
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("Expected zip response, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+
+	if len(zr.File) != 2 || zr.File[0].Name != "avatar-32.jpg" {
+		t.Errorf("Unexpected zip contents: %d files", len(zr.File))
+	}
+
+	if w := post(map[string]string{"variants": "32:nope"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for bad variants, got %d", w.Code)
+	}
+}
+
+// TestSrcsetEndpoint() - test srcset ladder JSON response with snippets
+func TestSrcsetEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	imgData, err := createTestImage()
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("avatar", "hero.png")
+	part.Write(imgData)
+	writer.WriteField("widths", "50,80,400")
+	writer.WriteField("formats", "png,jpeg")
+	writer.WriteField("url_prefix", "/img/")
+	writer.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/srcset", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Images []struct {
+			Filename    string `json:"filename"`
+			Width       int    `json:"width"`
+			DownloadURL string `json:"download_url"`
+		} `json:"images"`
+		HTML     string `json:"html"`
+		Markdown string `json:"markdown"`
+		ZipURL   string `json:"zip_url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	// 400w exceeds the 100px source and is skipped
+	if len(resp.Images) != 4 || resp.Images[0].Filename != "hero-50.png" || resp.ZipURL == "" {
+		t.Errorf("Unexpected srcset response: %+v", resp)
+	}
+
+	if !strings.Contains(resp.HTML, "/img/hero-80.jpg 80w") || !strings.Contains(resp.Markdown, "/img/hero-80.jpg") {
+		t.Errorf("Unexpected snippets: %s %s", resp.HTML, resp.Markdown)
+	}
+}
+
+// TestCompressEndpoint_Placeholder() - test that placeholder=true adds BlurHash and ThumbHash to the response
+func TestCompressEndpoint_Placeholder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	imgData, err := createTestImage()
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	for _, placeholder := range []string{"true", ""} {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("avatar", "test.png")
+		part.Write(imgData)
+		writer.WriteField("placeholder", placeholder)
+		writer.Close()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/compress", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+		}
+
+		var resp map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse JSON response: %v", err)
+		}
+
+		_, hasBlur := resp["blurhash"]
+		_, hasThumb := resp["thumbhash"]
+		if want := placeholder == "true"; hasBlur != want || hasThumb != want {
+			t.Errorf("placeholder=%q: expected hashes %v, got blurhash %v thumbhash %v", placeholder, want, hasBlur, hasThumb)
+		}
+	}
+}
+
+// TestCompressEndpoint_MaxSize() - test human-readable and relative maxsize values and the error for malformed ones
+func TestCompressEndpoint_MaxSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter()
+
+	imgData, err := createTestImage()
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	for maxSize, want := range map[string]int{"500KB": http.StatusOK, "90%": http.StatusOK, "lots": http.StatusBadRequest, "-1": http.StatusBadRequest} {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("avatar", "test.png")
+		part.Write(imgData)
+		writer.WriteField("maxsize", maxSize)
+		writer.WriteField("estimate", "true")
+		writer.Close()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/compress", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		r.ServeHTTP(w, req)
+
+		if w.Code != want {
+			t.Errorf("maxsize=%q: expected status %d, got %d. Body: %s", maxSize, want, w.Code, w.Body.String())
+		}
+	}
+}